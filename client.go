@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	sdk "github.com/google/go-github/v36/github"
+	gc "github.com/opensourceways/community-robot-lib/githubclient"
+	"golang.org/x/oauth2"
+)
+
+// ghClient implements the GitHub APIs which are not supported by community-robot-lib.
+type ghClient struct {
+	gc.Client
+
+	c *sdk.Client
+}
+
+func newGHClient(getToken func() []byte) *ghClient {
+	ts := oauth2.StaticTokenSource(&oauth2.Token{
+		AccessToken: string(getToken()),
+	})
+
+	return &ghClient{
+		Client: gc.NewClient(getToken),
+		c:      sdk.NewClient(oauth2.NewClient(context.Background(), ts)),
+	}
+}
+
+func isNotFound(resp *sdk.Response) bool {
+	return resp != nil && resp.StatusCode == http.StatusNotFound
+}
+
+// isNotFoundError returns true if the err is returned by GitHub because the resource is not found.
+func isNotFoundError(err error) bool {
+	var e *sdk.ErrorResponse
+
+	return errors.As(err, &e) && e.Response != nil && e.Response.StatusCode == http.StatusNotFound
+}
+
+// DeleteBranch deletes the branch.
+func (cl *ghClient) DeleteBranch(org, repo, branch string) error {
+	_, err := cl.c.Git.DeleteRef(context.Background(), org, repo, "heads/"+branch)
+	return err
+}
+
+// HasOpenPR returns true if there are open pull requests which are from or to the branch.
+func (cl *ghClient) HasOpenPR(org, repo, branch string) (bool, error) {
+	opts := []*sdk.PullRequestListOptions{
+		{State: "open", Base: branch},
+		{State: "open", Head: org + ":" + branch},
+	}
+
+	for _, opt := range opts {
+		opt.PerPage = 1
+
+		v, _, err := cl.c.PullRequests.List(context.Background(), org, repo, opt)
+		if err != nil {
+			return false, err
+		}
+
+		if len(v) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// TransferRepo transfers the repo to the new org. The transfer is done asynchronously by GitHub.
+func (cl *ghClient) TransferRepo(org, repo, newOrg string) error {
+	_, _, err := cl.c.Repositories.Transfer(
+		context.Background(), org, repo, sdk.TransferRequest{NewOwner: newOrg},
+	)
+	if _, ok := err.(*sdk.AcceptedError); ok {
+		return nil
+	}
+
+	return err
+}
+
+// ReplaceTopics replaces all the topics of the repo.
+func (cl *ghClient) ReplaceTopics(org, repo string, topics []string) error {
+	_, _, err := cl.c.Repositories.ReplaceAllTopics(context.Background(), org, repo, topics)
+	return err
+}
+
+// GetInteractionLimit returns the time when the interaction limit of the repo expires.
+// It returns zero time if the repo is not limited.
+func (cl *ghClient) GetInteractionLimit(org, repo string) (time.Time, error) {
+	v, _, err := cl.c.Interactions.GetRestrictionsForRepo(context.Background(), org, repo)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if t := v.GetExpiresAt().Time; t.After(time.Now()) {
+		return t, nil
+	}
+
+	return time.Time{}, nil
+}
+
+// SetInteractionLimit restricts the users who can comment, open issues or create pull
+// requests of the repo, and returns the time when the limit expires.
+func (cl *ghClient) SetInteractionLimit(org, repo, limit, expiry string) (time.Time, error) {
+	req, err := cl.c.NewRequest(
+		"PUT", fmt.Sprintf("repos/%s/%s/interaction-limits", org, repo),
+		struct {
+			Limit  string `json:"limit"`
+			Expiry string `json:"expiry"`
+		}{limit, expiry},
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	v := new(sdk.InteractionRestriction)
+	if _, err := cl.c.Do(context.Background(), req, v); err != nil {
+		return time.Time{}, err
+	}
+
+	return v.GetExpiresAt().Time, nil
+}
+
+// RemoveInteractionLimit removes the interaction limit of the repo.
+func (cl *ghClient) RemoveInteractionLimit(org, repo string) error {
+	_, err := cl.c.Interactions.RemoveRestrictionsFromRepo(context.Background(), org, repo)
+	return err
+}
+
+// RenameBranch renames the branch. GitHub updates the default branch and the pull requests
+// if the branch is the default one.
+func (cl *ghClient) RenameBranch(org, repo, branch, newName string) error {
+	req, err := cl.c.NewRequest(
+		"POST", fmt.Sprintf("repos/%s/%s/branches/%s/rename", org, repo, branch),
+		struct {
+			NewName string `json:"new_name"`
+		}{newName},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.c.Do(context.Background(), req, nil)
+	return err
+}
+
+// GetTeam returns nil if the team doesn't exist.
+func (cl *ghClient) GetTeam(org, slug string) (*sdk.Team, error) {
+	v, resp, err := cl.c.Teams.GetTeamBySlug(context.Background(), org, slug)
+	if err != nil && isNotFound(resp) {
+		return nil, nil
+	}
+
+	return v, err
+}
+
+// CreateTeam creates the team and returns it.
+func (cl *ghClient) CreateTeam(org, name, description string) (*sdk.Team, error) {
+	privacy := "closed"
+
+	v, _, err := cl.c.Teams.CreateTeam(context.Background(), org, sdk.NewTeam{
+		Name:        name,
+		Description: &description,
+		Privacy:     &privacy,
+	})
+
+	return v, err
+}
+
+// ListTeamMembers returns the members of team. It returns nil if the team doesn't exist.
+func (cl *ghClient) ListTeamMembers(org, slug string) ([]*sdk.User, error) {
+	opt := &sdk.TeamListTeamMembersOptions{
+		ListOptions: sdk.ListOptions{PerPage: 100},
+	}
+
+	var r []*sdk.User
+	for {
+		v, resp, err := cl.c.Teams.ListTeamMembersBySlug(context.Background(), org, slug, opt)
+		if err != nil {
+			if isNotFound(resp) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		r = append(r, v...)
+
+		if resp.NextPage == 0 {
+			return r, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+func (cl *ghClient) AddTeamMember(org, slug, login string) error {
+	_, _, err := cl.c.Teams.AddTeamMembershipBySlug(
+		context.Background(), org, slug, login,
+		&sdk.TeamAddTeamMembershipOptions{Role: "member"},
+	)
+
+	return err
+}
+
+func (cl *ghClient) RemoveTeamMember(org, slug, login string) error {
+	_, err := cl.c.Teams.RemoveTeamMembershipBySlug(context.Background(), org, slug, login)
+	return err
+}
+
+// AddTeamRepo grants the permission of repo to the team. It also updates the permission
+// if the team has been granted.
+func (cl *ghClient) AddTeamRepo(org, slug, repo, permission string) error {
+	_, err := cl.c.Teams.AddTeamRepoBySlug(
+		context.Background(), org, slug, org, repo,
+		&sdk.TeamAddTeamRepoOptions{Permission: permission},
+	)
+
+	return err
+}
+
+func (cl *ghClient) RemoveTeamRepo(org, slug, repo string) error {
+	_, err := cl.c.Teams.RemoveTeamRepoBySlug(context.Background(), org, slug, org, repo)
+	return err
+}
+
+// GetBranchProtection returns nil if the branch is not protected.
+func (cl *ghClient) GetBranchProtection(org, repo, branch string) (*sdk.Protection, error) {
+	p, resp, err := cl.c.Repositories.GetBranchProtection(context.Background(), org, repo, branch)
+	if err != nil && isNotFound(resp) {
+		return nil, nil
+	}
+
+	return p, err
+}
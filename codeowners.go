@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	sdk "github.com/google/go-github/v36/github"
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
+)
+
+const codeOwnersFile = ".github/CODEOWNERS"
+
+// genCodeOwners generates the content of CODEOWNERS which makes the owners and admins
+// of repo be the owners of all the files. The teams of sig are the owners instead of
+// their members if the teams are enabled.
+func genCodeOwners(e *expectRepoInfo) []byte {
+	s := make(map[string]bool)
+	for slug := range e.teams {
+		s[e.org+"/"+slug] = true
+	}
+
+	add := func(logins []string) {
+		for _, v := range logins {
+			if v = strings.ToLower(v); v != "" && e.teamMembers[v] == "" {
+				s[v] = true
+			}
+		}
+	}
+	add(e.expectOwners)
+	add(e.expectAdmins)
+
+	if len(s) == 0 {
+		return nil
+	}
+
+	items := make([]string, 0, len(s))
+	for k := range s {
+		items = append(items, "@"+k)
+	}
+	sort.Strings(items)
+
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "# This file is generated by %s. Don't edit it.\n", botName)
+	fmt.Fprintf(b, "* %s\n", strings.Join(items, " "))
+
+	return b.Bytes()
+}
+
+// handleCodeOwners makes the CODEOWNERS on the default branch be generated from the owners
+// and admins of repo. hash is the one of the content written last time, and the file is
+// updated only when the content changes. The protection of the default branch is lifted
+// while writing the file and restored afterwards. It returns the hash of the current content.
+func (bot *robot) handleCodeOwners(expectRepo expectRepoInfo, branch, hash string, log *logrus.Entry) string {
+	if !bot.cfg.MaintainCodeOwners {
+		return hash
+	}
+
+	c := genCodeOwners(&expectRepo)
+	if len(c) == 0 {
+		return hash
+	}
+
+	h := hashOfContent(c)
+	if h == hash {
+		return hash
+	}
+
+	org := expectRepo.org
+	repo := expectRepo.getNewRepoName()
+
+	if branch == "" {
+		v, err := bot.cli.GetRepo(org, repo)
+		if err != nil {
+			log.Errorf("get the default branch of repo:%s, err:%s", repo, err.Error())
+			return hash
+		}
+		branch = v.GetDefaultBranch()
+	}
+
+	sha := ""
+	if f, err := bot.cli.GetPathContent(org, repo, codeOwnersFile, branch); err == nil {
+		if v, err := f.GetContent(); err == nil && v == string(c) {
+			return h
+		}
+
+		sha = f.GetSHA()
+	}
+
+	log = log.WithField("update CODEOWNERS", fmt.Sprintf("%s/%s", repo, branch))
+
+	p, err := bot.cli.GetBranchProtection(org, repo, branch)
+	if err != nil {
+		log.Errorf("get the protection, err:%s", err.Error())
+		return hash
+	}
+
+	if p != nil {
+		if err := bot.cli.RemoveProtectionBranch(org, repo, branch); err != nil {
+			log.Errorf("lift the protection, err:%s", err.Error())
+			return hash
+		}
+
+		defer bot.restoreProtection(org, repo, branch, p, log)
+	}
+
+	log.Info("start")
+
+	if err := bot.cli.CreateFile(org, repo, codeOwnersFile, branch, "update CODEOWNERS", sha, c); err != nil {
+		log.Error(err)
+		return hash
+	}
+
+	recordChange(changeCodeOwnersUpdated)
+
+	return h
+}
+
+// restoreProtection protects the branch again with the rules lifted before. The drift left
+// by a failure is reverted when the protection is refreshed.
+func (bot *robot) restoreProtection(org, repo, branch string, p *sdk.Protection, log *logrus.Entry) {
+	b := community.RepoBranch{Name: branch}
+	b.Type, b.Protection = toBranchProtection(p)
+
+	if err := bot.cli.SetProtectionBranch(org, repo, branch, toProtectionRequest(&b)); err != nil {
+		log.Errorf("restore the protection, err:%s", err.Error())
+	}
+}
+
+func hashOfContent(c []byte) string {
+	v := sha256.Sum256(c)
+	return hex.EncodeToString(v[:])
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	sdk "github.com/google/go-github/v36/github"
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
+)
+
+type codeOwnersClient struct {
+	iClient
+
+	calls []string
+}
+
+func (c *codeOwnersClient) GetPathContent(org, repo, path, branch string) (*sdk.RepositoryContent, error) {
+	return nil, &sdk.ErrorResponse{}
+}
+
+func (c *codeOwnersClient) GetBranchProtection(org, repo, branch string) (*sdk.Protection, error) {
+	return &sdk.Protection{EnforceAdmins: &sdk.AdminEnforcement{Enabled: true}}, nil
+}
+
+func (c *codeOwnersClient) RemoveProtectionBranch(org, repo, branch string) error {
+	c.calls = append(c.calls, "unprotect")
+	return nil
+}
+
+func (c *codeOwnersClient) CreateFile(org, repo, path, branch, message, sha string, content []byte) error {
+	c.calls = append(c.calls, "write")
+	return nil
+}
+
+func (c *codeOwnersClient) SetProtectionBranch(org, repo, branch string, pre *sdk.ProtectionRequest) error {
+	c.calls = append(c.calls, "protect")
+	if !pre.EnforceAdmins {
+		c.calls = append(c.calls, "lost the rules")
+	}
+	return nil
+}
+
+func TestHandleCodeOwnersOfProtectedBranch(t *testing.T) {
+	cli := &codeOwnersClient{}
+	bot := robot{cli: cli, cfg: &botConfig{MaintainCodeOwners: true}}
+
+	e := expectRepoInfo{
+		expectRepoState: &community.Repository{Name: "test"},
+		expectOwners:    []string{"a"},
+		org:             "openeuler",
+	}
+
+	h := bot.handleCodeOwners(e, "master", "", logrus.NewEntry(logrus.New()))
+	if h != hashOfContent(genCodeOwners(&e)) {
+		t.Errorf("unexpected hash: %s", h)
+	}
+
+	if v := strings.Join(cli.calls, ","); v != "unprotect,write,protect" {
+		t.Errorf("unexpected calls: %s", v)
+	}
+}
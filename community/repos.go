@@ -10,6 +10,7 @@ import (
 const (
 	BranchMaster    = "master"
 	BranchProtected = "protected"
+	BranchReadonly  = "readonly"
 )
 
 type Repos struct {
@@ -76,6 +77,8 @@ type Repository struct {
 	Type              string       `json:"type" required:"true"`
 	RenameFrom        string       `json:"rename_from,omitempty"`
 	Description       string       `json:"description,omitempty"`
+	Homepage          string       `json:"homepage,omitempty"`
+	Topics            []string     `json:"topics,omitempty"`
 	Commentable       bool         `json:"commentable,omitempty"`
 	ProtectedBranches []string     `json:"protected_branches,omitempty"`
 	RepoUrl           string       `json:"repository_url"`
@@ -83,6 +86,7 @@ type Repository struct {
 	Branches          []RepoBranch `json:"branches,omitempty"`
 
 	RepoMember
+	RepoSettings
 }
 
 func (r *Repository) Validate() error {
@@ -131,10 +135,135 @@ type RepoMember struct {
 	Developers []string `json:"developers,omitempty"`
 }
 
+// RepoSettings is the feature settings of a repo on GitHub. Unset means it is not managed.
+type RepoSettings struct {
+	HasIssues           *bool  `json:"has_issues,omitempty"`
+	HasWiki             *bool  `json:"has_wiki,omitempty"`
+	HasProjects         *bool  `json:"has_projects,omitempty"`
+	AllowSquashMerge    *bool  `json:"allow_squash_merge,omitempty"`
+	AllowMergeCommit    *bool  `json:"allow_merge_commit,omitempty"`
+	AllowRebaseMerge    *bool  `json:"allow_rebase_merge,omitempty"`
+	DeleteBranchOnMerge *bool  `json:"delete_branch_on_merge,omitempty"`
+	DefaultBranch       string `json:"default_branch,omitempty"`
+}
+
+func (s *RepoSettings) bools() []**bool {
+	return []**bool{
+		&s.HasIssues, &s.HasWiki, &s.HasProjects,
+		&s.AllowSquashMerge, &s.AllowMergeCommit, &s.AllowRebaseMerge,
+		&s.DeleteBranchOnMerge,
+	}
+}
+
+// Merge returns the settings whose unset items are filled by the ones of d.
+func (s *RepoSettings) Merge(d *RepoSettings) RepoSettings {
+	r := *s
+
+	items, defaults := r.bools(), d.bools()
+	for i := range items {
+		if *items[i] == nil {
+			*items[i] = *defaults[i]
+		}
+	}
+
+	if r.DefaultBranch == "" {
+		r.DefaultBranch = d.DefaultBranch
+	}
+
+	return r
+}
+
+// Diff returns the items of expect which are set and different from s.
+// It returns false if there is no such item.
+func (s *RepoSettings) Diff(expect *RepoSettings) (RepoSettings, bool) {
+	r := RepoSettings{}
+	changed := false
+
+	items, current, expected := r.bools(), s.bools(), expect.bools()
+	for i := range expected {
+		e := *expected[i]
+		if e == nil {
+			continue
+		}
+
+		if c := *current[i]; c == nil || *c != *e {
+			*items[i] = e
+			changed = true
+		}
+	}
+
+	if expect.DefaultBranch != "" && expect.DefaultBranch != s.DefaultBranch {
+		r.DefaultBranch = expect.DefaultBranch
+		changed = true
+	}
+
+	return r, changed
+}
+
+// Update sets the items of s which are set in s1.
+func (s *RepoSettings) Update(s1 *RepoSettings) {
+	items, updates := s.bools(), s1.bools()
+	for i := range updates {
+		if v := *updates[i]; v != nil {
+			b := *v
+			*items[i] = &b
+		}
+	}
+
+	if s1.DefaultBranch != "" {
+		s.DefaultBranch = s1.DefaultBranch
+	}
+}
+
 type RepoBranch struct {
-	Name       string `json:"name" required:"true"`
-	Type       string `json:"type,omitempty"`
-	CreateFrom string `json:"create_from,omitempty"`
+	Name       string            `json:"name" required:"true"`
+	Type       string            `json:"type,omitempty"`
+	CreateFrom string            `json:"create_from,omitempty"`
+	Protection *BranchProtection `json:"protection,omitempty"`
+}
+
+// BranchProtection is the protection rules of a protected branch.
+type BranchProtection struct {
+	// RequiredReviews is the number of approving reviews required before merging.
+	RequiredReviews     int  `json:"required_reviews,omitempty"`
+	DismissStaleReviews bool `json:"dismiss_stale_reviews,omitempty"`
+
+	// RequiredStatusChecks is the status checks which must pass before merging.
+	RequiredStatusChecks []string `json:"required_status_checks,omitempty"`
+
+	// StrictStatusChecks means the branch must be up to date before merging.
+	StrictStatusChecks bool `json:"strict_status_checks,omitempty"`
+
+	EnforceAdmins bool `json:"enforce_admins,omitempty"`
+
+	// PushTeams is the slugs of the teams which are allowed to push.
+	// Empty means the pushers are not restricted.
+	PushTeams []string `json:"push_teams,omitempty"`
+}
+
+// Equal returns true if the two are the same rules. The order of the items of
+// lists is ignored.
+func (p *BranchProtection) Equal(p1 *BranchProtection) bool {
+	v, v1 := BranchProtection{}, BranchProtection{}
+	if p != nil {
+		v = *p
+	}
+	if p1 != nil {
+		v1 = *p1
+	}
+
+	return v.RequiredReviews == v1.RequiredReviews &&
+		v.DismissStaleReviews == v1.DismissStaleReviews &&
+		v.StrictStatusChecks == v1.StrictStatusChecks &&
+		v.EnforceAdmins == v1.EnforceAdmins &&
+		sets.NewString(v.RequiredStatusChecks...).Equal(sets.NewString(v1.RequiredStatusChecks...)) &&
+		sets.NewString(v.PushTeams...).Equal(sets.NewString(v1.PushTeams...))
+}
+
+// IsProtected returns true if the branch should be protected on GitHub.
+// A readonly branch is a protected one which nobody can push to.
+func (r *RepoBranch) IsProtected() bool {
+	return r.Type == BranchProtected || r.Type == BranchReadonly
 }
 
 func (r *RepoBranch) validate() error {
@@ -258,6 +387,7 @@ type SigInfos struct {
 	admins           map[string][]string `json:"-"`
 	owners           []string            `json:"-"`
 	additionalOwners map[string][]string `json:"-"`
+	contributors     map[string][]string `json:"-"`
 }
 
 type Maintainer struct {
@@ -399,6 +529,7 @@ func (s *SigInfos) Validate() error {
 func (s *SigInfos) convert() {
 	v := make(map[string][]string, 0)
 	k := make(map[string][]string, 0)
+	c := make(map[string][]string, 0)
 
 	for _, item := range s.Repositories {
 		admins := make([]string, 0)
@@ -416,6 +547,14 @@ func (s *SigInfos) convert() {
 		for _, m := range item.Repo {
 			k[m] = committers
 		}
+
+		contributors := make([]string, 0)
+		for _, i := range item.Contributors {
+			contributors = append(contributors, strings.ToLower(i.GiteeId))
+		}
+		for _, m := range item.Repo {
+			c[m] = contributors
+		}
 	}
 
 	j := make([]string, 0)
@@ -426,6 +565,7 @@ func (s *SigInfos) convert() {
 	s.admins = v
 	s.owners = j
 	s.additionalOwners = k
+	s.contributors = c
 }
 
 func (s *SigInfos) GetRepoAdmin() map[string][]string {
@@ -444,6 +584,14 @@ func (s *SigInfos) GetRepoAdditionalOwners() map[string][]string {
 	return s.additionalOwners
 }
 
+func (s *SigInfos) GetRepoContributors() map[string][]string {
+	if s == nil {
+		return nil
+	}
+
+	return s.contributors
+}
+
 func (s *SigInfos) GetRepoOwners() []string {
 	if s == nil {
 		return nil
@@ -0,0 +1,27 @@
+package community
+
+import "testing"
+
+func TestRepoSettingsDiff(t *testing.T) {
+	yes, no := true, false
+
+	org := RepoSettings{HasIssues: &yes, HasWiki: &yes, DefaultBranch: "main"}
+	repo := RepoSettings{HasWiki: &no, AllowRebaseMerge: &no}
+	expect := repo.Merge(&org)
+
+	current := RepoSettings{HasIssues: &yes, HasWiki: &yes, AllowRebaseMerge: &no, DefaultBranch: "master"}
+
+	d, changed := current.Diff(&expect)
+	if !changed {
+		t.Fatal("settings should be changed")
+	}
+
+	if d.HasIssues != nil || d.AllowRebaseMerge != nil || d.HasWiki == nil || *d.HasWiki || d.DefaultBranch != "main" {
+		t.Errorf("unexpected diff: %+v", d)
+	}
+
+	current.Update(&d)
+	if _, changed := current.Diff(&expect); changed {
+		t.Errorf("settings should be same after updating: %+v", current)
+	}
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/huaweicloud/golangsdk"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
 )
 
 type configuration struct {
@@ -20,12 +24,66 @@ func (c *configuration) Validate() error {
 }
 
 func (c *configuration) SetDefault() {
+	if c == nil {
+		return
+	}
+
+	c.Config.setDefault()
 }
 
 type repoBranch struct {
 	Org    string `json:"org" required:"true"`
 	Repo   string `json:"repo" required:"true"`
 	Branch string `json:"branch" required:"true"`
+
+	// Source is where the files of the branch are read from. It is gitee, github, git or dir.
+	// gitee and github mean the API of them, git means a local clone of the branch, and dir
+	// means a directory on disk. The default value is gitee.
+	Source string `json:"source,omitempty"`
+
+	// Git is the local clone of the branch which is used if the source is git.
+	Git gitSourceConfig `json:"git,omitempty"`
+
+	// Dir is the directory which includes the files of the branch. It is used if the source is dir.
+	Dir string `json:"dir,omitempty"`
+}
+
+func (b *repoBranch) setDefault() {
+	if b.Source == "" {
+		b.Source = sourceGitee
+	}
+
+	if b.Source == sourceGit && b.Git.URL == "" {
+		b.Git.URL = fmt.Sprintf("https://gitee.com/%s/%s.git", b.Org, b.Repo)
+	}
+}
+
+func (b *repoBranch) validate() error {
+	switch b.Source {
+	case sourceGitee, sourceGithub:
+	case sourceGit:
+		if b.Git.Dir == "" {
+			return fmt.Errorf("missing git.dir of %s/%s", b.Org, b.Repo)
+		}
+	case sourceDir:
+		if b.Dir == "" {
+			return fmt.Errorf("missing dir of %s/%s", b.Org, b.Repo)
+		}
+	default:
+		return fmt.Errorf("unknown source: %s", b.Source)
+	}
+
+	return nil
+}
+
+// gitSourceConfig is the local clone of a branch.
+type gitSourceConfig struct {
+	// URL is the url to clone the repo. The default value is the one on Gitee.
+	URL string `json:"url,omitempty"`
+
+	// Dir is the directory where the repo is cloned to. It is fetched on each check,
+	// so the files are read from it without calling the API.
+	Dir string `json:"dir,omitempty"`
 }
 
 // The repo which includes the repository and sig information that will be watched
@@ -43,13 +101,17 @@ type watchingFiles struct {
 }
 
 func (w *watchingFiles) validate() error {
-	_, err := golangsdk.BuildRequestBody(w, "")
-	return err
+	if _, err := golangsdk.BuildRequestBody(w, ""); err != nil {
+		return err
+	}
+
+	return w.repoBranch.validate()
 }
 
 // obsMetaProject includes the information about the obs meta repo and the new project
 type obsMetaProject struct {
-	// Branch is the one which the project file will be writed to
+	// Branch is the one which the project file will be writed to.
+	// It is on GitHub unless the source is set.
 	Branch repoBranch `json:"obs_repo" required:"true"`
 
 	// ProjectDir is the diectory of the new project
@@ -59,11 +121,63 @@ type obsMetaProject struct {
 	ProjectFileName string `json:"project_file_name" required:"true"`
 }
 
+func (o *obsMetaProject) setDefault() {
+	if o.Branch.Source == "" {
+		o.Branch.Source = sourceGithub
+	}
+
+	o.Branch.setDefault()
+}
+
 func (o *obsMetaProject) validate() error {
 	if _, err := golangsdk.BuildRequestBody(o, ""); err != nil {
 		return err
 	}
 
+	return o.Branch.validate()
+}
+
+// watchTarget is a community repo and the GitHub org which the repos declared by it are created in.
+type watchTarget struct {
+	watchingFiles
+
+	// GithubOrg is the GitHub organization which the repos are created in. Default is RepoOrg.
+	GithubOrg string `json:"github_org,omitempty"`
+
+	// EnableCreatingOBSMetaProject is the switch of creating project in obs meta repo
+	EnableCreatingOBSMetaProject bool `json:"enable_creating_obs_meta_project,omitempty"`
+
+	OBSMetaProject obsMetaProject `json:"obs_meta_project"`
+}
+
+func (t *watchTarget) setDefault() {
+	t.repoBranch.setDefault()
+	t.OBSMetaProject.setDefault()
+
+	if t.GithubOrg == "" {
+		t.GithubOrg = t.RepoOrg
+	}
+}
+
+func (t *watchTarget) validate() error {
+	if err := t.watchingFiles.validate(); err != nil {
+		return err
+	}
+
+	if t.EnableCreatingOBSMetaProject {
+		return t.OBSMetaProject.validate()
+	}
+
+	return nil
+}
+
+// obsProject returns the obs meta project which the new repos are added to.
+// It returns nil if it is disabled.
+func (t *watchTarget) obsProject() *obsMetaProject {
+	if t.EnableCreatingOBSMetaProject {
+		return &t.OBSMetaProject
+	}
+
 	return nil
 }
 
@@ -72,7 +186,13 @@ func (o *obsMetaProject) genProjectFilePath(p string) string {
 }
 
 type botConfig struct {
-	WatchingFiles watchingFiles `json:"watching_files" required:"true"`
+	// WatchingFiles, EnableCreatingOBSMetaProject and OBSMetaProject are the single target
+	// to be watched. They are ignored if Targets is set.
+	WatchingFiles watchingFiles `json:"watching_files,omitempty"`
+
+	// Targets is the targets to be watched by one process. They share the goroutine pool
+	// and the clients.
+	Targets []watchTarget `json:"targets,omitempty"`
 
 	// ConcurrentSize is the concurrent size for doing task
 	ConcurrentSize int `json:"concurrent_size" required:"true"`
@@ -87,6 +207,343 @@ type botConfig struct {
 	OBSMetaProject obsMetaProject `json:"obs_meta_project"`
 
 	OMApi OMApi `json:"om_api"`
+
+	Snapshot snapshotConfig `json:"snapshot"`
+
+	// Permissions is the GitHub permission of each role of a repo.
+	Permissions permissionConfig `json:"permissions"`
+
+	// IdentityMappingFile is the path to a yaml file of gitee_id -> github_login
+	// which is consulted before the OM service.
+	IdentityMappingFile string `json:"identity_mapping_file,omitempty"`
+
+	// IdentityMappingOnly means only the identity mapping file is used and the OM service is not called.
+	IdentityMappingOnly bool `json:"identity_mapping_only,omitempty"`
+
+	// UnmappedReportFile is the path to which the owners and admins that can't be
+	// mapped to GitHub are written after each check.
+	UnmappedReportFile string `json:"unmapped_report_file,omitempty"`
+
+	// BranchProtection is the default protection rules of the protected branches
+	// which don't declare their own rules.
+	BranchProtection branchProtectionConfig `json:"branch_protection"`
+
+	Recycle recycleConfig `json:"recycle"`
+
+	Orphan orphanConfig `json:"orphan"`
+
+	Templates templateConfig `json:"templates"`
+
+	Teams teamConfig `json:"teams"`
+
+	// MaintainCodeOwners means the CODEOWNERS on the default branch of repos is generated
+	// from the owners and admins of repos and kept up to date.
+	MaintainCodeOwners bool `json:"maintain_codeowners,omitempty"`
+
+	// CommentLimit is the interaction limit applied to the repos which are not commentable.
+	// It is existing_users, contributors_only or collaborators_only. Unset means the
+	// commentable property of repos is not enforced.
+	CommentLimit string `json:"comment_limit,omitempty"`
+
+	// RepoSettings is the org -> default feature settings of the repos, which can be
+	// overridden by the repository file. Issues and wiki are enabled by default.
+	RepoSettings map[string]community.RepoSettings `json:"repo_settings,omitempty"`
+
+	// UndeclaredBranch is the org -> policy of the branches which exist on GitHub
+	// but are not declared in the repository file. They are left as they are by default.
+	UndeclaredBranch map[string]undeclaredBranchPolicy `json:"undeclared_branch,omitempty"`
+
+	// LivenessMultiple is the multiple of interval. The watcher is regarded as not alive
+	// if no check has completed within it. The default value is 3.
+	LivenessMultiple int `json:"liveness_multiple,omitempty"`
+}
+
+// snapshotConfig is the configuration of persisting the states of repos
+type snapshotConfig struct {
+	// Dir is the directory where the states are saved to. Unset means not to persist them.
+	Dir string `json:"dir,omitempty"`
+
+	// TTL is the duration after which a restored state is regarded as stale and
+	// will be revalidated in background. 0 or unset means never. The unit is minute.
+	TTL int `json:"ttl,omitempty"`
+}
+
+// permissionConfig maps the roles of a repo to the GitHub permissions which are
+// pull, triage, push, maintain or admin. Empty means the role is not granted.
+type permissionConfig struct {
+	// Maintainer is the maintainer of sig. The default value is push.
+	Maintainer string `json:"maintainer,omitempty"`
+
+	// Committer is the committer in sig-info.yaml. The default value is push.
+	Committer string `json:"committer,omitempty"`
+
+	// Admin is the admin of repo in sig-info.yaml. The default value is maintain.
+	Admin string `json:"admin,omitempty"`
+
+	// Contributor is the contributor in sig-info.yaml. It is not granted by default.
+	Contributor string `json:"contributor,omitempty"`
+}
+
+func (p *permissionConfig) setDefault() {
+	if p.Maintainer == "" {
+		p.Maintainer = permissionPush
+	}
+
+	if p.Committer == "" {
+		p.Committer = permissionPush
+	}
+
+	if p.Admin == "" {
+		p.Admin = permissionMaintain
+	}
+}
+
+func (p *permissionConfig) validate() error {
+	for _, v := range []string{p.Maintainer, p.Committer, p.Admin, p.Contributor} {
+		if _, ok := permissionLevels[v]; v != "" && !ok {
+			return fmt.Errorf("unknown permission: %s", v)
+		}
+	}
+
+	return nil
+}
+
+type branchProtectionConfig struct {
+	// Default is applied to the protected branches whose sig is not in Sigs.
+	// Unset means the branches are protected without any rules.
+	Default *community.BranchProtection `json:"default,omitempty"`
+
+	// Sigs is the sig name -> the rules applied to the protected branches of the repos of sig.
+	Sigs map[string]community.BranchProtection `json:"sigs,omitempty"`
+
+	// RefreshInterval is the interval of comparing the rules with the live ones on GitHub,
+	// so that the changes made on GitHub are reverted. The unit is minute.
+	RefreshInterval int `json:"refresh_interval,omitempty"`
+}
+
+func (b *branchProtectionConfig) setDefault() {
+	if b.RefreshInterval <= 0 {
+		b.RefreshInterval = 60
+	}
+}
+
+func (b *branchProtectionConfig) refreshInterval() time.Duration {
+	return time.Duration(b.RefreshInterval) * time.Minute
+}
+
+// get returns the rules for the protected branches of the repos of sig.
+func (b *branchProtectionConfig) get(sig string) *community.BranchProtection {
+	if v, ok := b.Sigs[sig]; ok {
+		return &v
+	}
+
+	if b.Default != nil {
+		v := *b.Default
+		return &v
+	}
+
+	return &community.BranchProtection{}
+}
+
+// teamConfig is the configuration of managing the members of sig by GitHub teams.
+type teamConfig struct {
+	// Enable means a team is maintained for each sig. Its members are the maintainers of sig
+	// and it is granted the permission of maintainer on every repo of sig. The maintainers
+	// are not added to the repos as collaborators individually.
+	Enable bool `json:"enable,omitempty"`
+
+	// AdminTeam means the team of <sig>-admins is maintained too. Its members are the admins
+	// of all the repos of sig and it is granted the permission of admin on every repo of sig.
+	AdminTeam bool `json:"admin_team,omitempty"`
+
+	// SyncInterval is the interval of synchronizing the members of team even if the
+	// expected ones don't change. The unit is minute. The default value is 60.
+	SyncInterval int `json:"sync_interval,omitempty"`
+}
+
+func (t *teamConfig) setDefault() {
+	if t.SyncInterval <= 0 {
+		t.SyncInterval = 60
+	}
+}
+
+func (t *teamConfig) syncInterval() time.Duration {
+	return time.Duration(t.SyncInterval) * time.Minute
+}
+
+// templateConfig is the templates which the newly created repos are initialized with.
+type templateConfig struct {
+	// Orgs is the org -> template of the repos of org.
+	Orgs map[string]repoTemplate `json:"orgs,omitempty"`
+
+	// Sigs is the sig name -> template of the repos of sig, which precedes the one of org.
+	Sigs map[string]repoTemplate `json:"sigs,omitempty"`
+}
+
+// get returns nil if there is no template for the repo.
+func (t *templateConfig) get(org, sig string) *repoTemplate {
+	if v, ok := t.Sigs[sig]; ok {
+		return &v
+	}
+
+	if v, ok := t.Orgs[org]; ok {
+		return &v
+	}
+
+	return nil
+}
+
+func (t *templateConfig) validate() error {
+	for k, v := range t.Orgs {
+		if err := v.validate(); err != nil {
+			return fmt.Errorf("template of org %s: %s", k, err.Error())
+		}
+	}
+
+	for k, v := range t.Sigs {
+		if err := v.validate(); err != nil {
+			return fmt.Errorf("template of sig %s: %s", k, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// repoTemplate is the files which are copied to the newly created repo. It is either
+// a GitHub repo or a local directory.
+type repoTemplate struct {
+	// Repo is the GitHub repo in the format of org/repo.
+	Repo string `json:"repo,omitempty"`
+
+	// Branch is the branch of Repo.
+	Branch string `json:"branch,omitempty"`
+
+	// Dir is the local directory.
+	Dir string `json:"dir,omitempty"`
+
+	// CodeOwners means to generate the CODEOWNERS from the owners of repo
+	// if the template doesn't include it.
+	CodeOwners bool `json:"codeowners,omitempty"`
+
+	// Overwrite means to overwrite the files which exist in the repo. The README
+	// created by GitHub is always overwritten.
+	Overwrite bool `json:"overwrite,omitempty"`
+}
+
+func (t *repoTemplate) orgRepo() (string, string) {
+	v := strings.Split(t.Repo, "/")
+	return v[0], v[1]
+}
+
+func (t *repoTemplate) validate() error {
+	if (t.Repo == "") == (t.Dir == "") {
+		return fmt.Errorf("one and only one of repo and dir must be set")
+	}
+
+	if t.Repo != "" {
+		if v := strings.Split(t.Repo, "/"); len(v) != 2 || v[0] == "" || v[1] == "" {
+			return fmt.Errorf("invalid repo: %s", t.Repo)
+		}
+
+		if t.Branch == "" {
+			return fmt.Errorf("missing branch of repo: %s", t.Repo)
+		}
+	}
+
+	return nil
+}
+
+// recycleConfig is the policy of the repos which are moved to sig-recycle.
+type recycleConfig struct {
+	// Enable means the recycled repos are archived and the collaborators who can push
+	// are removed. The repos will be unarchived if they are moved back to a live sig.
+	// Unset means the recycled repos are skipped.
+	Enable bool `json:"enable,omitempty"`
+
+	// AtticOrg is the org which the recycled repos are transferred to after being archived.
+	// Unset means not to transfer them.
+	AtticOrg string `json:"attic_org,omitempty"`
+}
+
+const (
+	orphanIgnore              = "ignore"
+	orphanReport              = "report"
+	orphanArchive             = "archive"
+	orphanRemoveCollaborators = "remove_collaborators"
+)
+
+// orphanConfig is the policy of the repos whose repository files are deleted.
+type orphanConfig struct {
+	// Action is ignore, report, archive or remove_collaborators. The default value is ignore.
+	Action string `json:"action,omitempty"`
+
+	// ReportFile is the path to which the repos of org that are not declared by any
+	// repository file are written. Unset means not to report.
+	ReportFile string `json:"report_file,omitempty"`
+
+	// ReportInterval is the interval of writing the report. The default value is 1440.
+	// The unit is minute.
+	ReportInterval int `json:"report_interval,omitempty"`
+}
+
+func (o *orphanConfig) setDefault() {
+	if o.Action == "" {
+		o.Action = orphanIgnore
+	}
+
+	if o.ReportInterval <= 0 {
+		o.ReportInterval = 1440
+	}
+}
+
+func (o *orphanConfig) validate() error {
+	switch o.Action {
+	case orphanIgnore, orphanReport, orphanArchive, orphanRemoveCollaborators:
+		return nil
+	default:
+		return fmt.Errorf("unknown action of orphan repo: %s", o.Action)
+	}
+}
+
+const (
+	undeclaredBranchNone      = "none"
+	undeclaredBranchUnprotect = "unprotect"
+	undeclaredBranchDelete    = "delete"
+)
+
+// undeclaredBranchPolicy is the policy of the branches which are not declared. The default
+// branch and the branches which have open pull requests are never touched.
+type undeclaredBranchPolicy struct {
+	// Action is none, unprotect or delete. The default value is none.
+	Action string `json:"action,omitempty"`
+
+	// GracePeriod is the duration between a branch is found not declared and it is deleted.
+	// The unit is minute. The default value is 1440.
+	GracePeriod int `json:"grace_period,omitempty"`
+}
+
+func (p *undeclaredBranchPolicy) setDefault() {
+	if p.GracePeriod <= 0 {
+		p.GracePeriod = 1440
+	}
+}
+
+func (p *undeclaredBranchPolicy) validate() error {
+	switch p.Action {
+	case "", undeclaredBranchNone, undeclaredBranchUnprotect, undeclaredBranchDelete:
+	default:
+		return fmt.Errorf("unknown action of undeclared branch: %s", p.Action)
+	}
+
+	return nil
+}
+
+func (p *undeclaredBranchPolicy) isNone() bool {
+	return p.Action == "" || p.Action == undeclaredBranchNone
+}
+
+func (p *undeclaredBranchPolicy) gracePeriod() time.Duration {
+	return time.Duration(p.GracePeriod) * time.Minute
 }
 
 type OMApi struct {
@@ -94,19 +551,148 @@ type OMApi struct {
 	AppSecret        string `json:"app_secret"`
 	EndpointGetToken string `json:"endpoint_get_token"`
 	EndpointGetUser  string `json:"endpoint_get_user"`
+
+	// TokenTTL is the duration for which a token is reused. The unit is minute.
+	TokenTTL int `json:"token_ttl,omitempty"`
+
+	// CacheTTL is the duration for which a found user is cached. The unit is minute.
+	CacheTTL int `json:"cache_ttl,omitempty"`
+
+	// NegativeCacheTTL is the duration for which a user not found is cached. The unit is minute.
+	NegativeCacheTTL int `json:"negative_cache_ttl,omitempty"`
+}
+
+func (o *OMApi) setDefault() {
+	if o.TokenTTL <= 0 {
+		o.TokenTTL = 30
+	}
+
+	if o.CacheTTL <= 0 {
+		o.CacheTTL = 360
+	}
+
+	if o.NegativeCacheTTL <= 0 {
+		o.NegativeCacheTTL = 30
+	}
+}
+
+func (c *botConfig) setDefault() {
+	if c.LivenessMultiple <= 0 {
+		c.LivenessMultiple = 3
+	}
+
+	if len(c.Targets) == 0 && c.WatchingFiles.Org != "" {
+		c.Targets = []watchTarget{{
+			watchingFiles:                c.WatchingFiles,
+			EnableCreatingOBSMetaProject: c.EnableCreatingOBSMetaProject,
+			OBSMetaProject:               c.OBSMetaProject,
+		}}
+	}
+
+	for i := range c.Targets {
+		c.Targets[i].setDefault()
+	}
+
+	c.OMApi.setDefault()
+	c.Permissions.setDefault()
+	c.Orphan.setDefault()
+	c.BranchProtection.setDefault()
+	c.Teams.setDefault()
+
+	for org, p := range c.UndeclaredBranch {
+		p.setDefault()
+		c.UndeclaredBranch[org] = p
+	}
+}
+
+// repoSettings returns the feature settings of the repo of org.
+func (c *botConfig) repoSettings(org string, repo *community.Repository) community.RepoSettings {
+	enabled := true
+	builtin := community.RepoSettings{
+		HasIssues: &enabled,
+		HasWiki:   &enabled,
+	}
+
+	d := c.RepoSettings[org]
+	d = d.Merge(&builtin)
+
+	return repo.RepoSettings.Merge(&d)
+}
+
+// livenessTimeout returns the duration within which a check should complete.
+// It is based on 10 minutes if the interval is less than that.
+func (c *botConfig) livenessTimeout() time.Duration {
+	interval := c.Interval
+	if interval < 10 {
+		interval = 10
+	}
+
+	return time.Duration(interval*c.LivenessMultiple) * time.Minute
+}
+
+// orphanReportFile returns the file which the orphan repos of org are reported to.
+// The org is appended to the file name if there are more than one targets.
+func (c *botConfig) orphanReportFile(org string) string {
+	f := c.Orphan.ReportFile
+	if f == "" || len(c.Targets) <= 1 {
+		return f
+	}
+
+	ext := path.Ext(f)
+
+	return strings.TrimSuffix(f, ext) + "-" + org + ext
 }
 
 func (c *botConfig) validate() error {
-	if err := c.WatchingFiles.validate(); err != nil {
-		return err
+	if len(c.Targets) == 0 {
+		return fmt.Errorf("missing targets or watching_files")
+	}
+
+	orgs := make(map[string]bool, len(c.Targets))
+	for i := range c.Targets {
+		t := &c.Targets[i]
+
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("target %d: %s", i, err.Error())
+		}
+
+		if orgs[t.GithubOrg] {
+			return fmt.Errorf("duplicate github_org of targets: %s", t.GithubOrg)
+		}
+		orgs[t.GithubOrg] = true
 	}
 
 	if c.ConcurrentSize <= 0 {
 		return fmt.Errorf("concurrent_size must be bigger than 0")
 	}
 
-	if c.EnableCreatingOBSMetaProject {
-		return c.OBSMetaProject.validate()
+	if err := c.Permissions.validate(); err != nil {
+		return err
+	}
+
+	switch c.CommentLimit {
+	case "", "existing_users", "contributors_only", "collaborators_only":
+	default:
+		return fmt.Errorf("unknown comment_limit: %s", c.CommentLimit)
+	}
+
+	if err := c.Templates.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Orphan.validate(); err != nil {
+		return err
+	}
+
+	for org, p := range c.UndeclaredBranch {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("org %s: %s", org, err.Error())
+		}
 	}
+
+	if c.IdentityMappingOnly && c.IdentityMappingFile == "" {
+		return fmt.Errorf("identity_mapping_file must be set if identity_mapping_only is true")
+	}
+
 	return nil
 }
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	sdk "github.com/google/go-github/v36/github"
+	gc "github.com/opensourceways/community-robot-lib/githubclient"
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
+)
+
+const (
+	actionCreateRepo         = "create_repo"
+	actionRenameRepo         = "rename_repo"
+	actionUpdateRepo         = "update_repo"
+	actionTransferRepo       = "transfer_repo"
+	actionReplaceTopics      = "replace_topics"
+	actionLimitInteraction   = "limit_interaction"
+	actionUnlimitInteraction = "unlimit_interaction"
+	actionCreateBranch       = "create_branch"
+	actionProtectBranch      = "protect_branch"
+	actionUnprotectBranch    = "unprotect_branch"
+	actionDeleteBranch       = "delete_branch"
+	actionRenameBranch       = "rename_branch"
+	actionAddCollaborator    = "add_collaborator"
+	actionRemoveCollaborator = "remove_collaborator"
+	actionPromoteMaintain    = "promote_to_maintain"
+	actionCreateFile         = "create_file"
+	actionCreateTeam         = "create_team"
+	actionAddTeamMember      = "add_team_member"
+	actionRemoveTeamMember   = "remove_team_member"
+	actionAddTeamRepo        = "add_team_repo"
+	actionRemoveTeamRepo     = "remove_team_repo"
+)
+
+// planAction is a mutation which would be applied to GitHub if not in dry-run mode.
+type planAction struct {
+	Action string `json:"action"`
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	Target string `json:"target,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type plan struct {
+	lock    sync.Mutex
+	actions []planAction
+
+	// createdRepos records the repos which would be created, so that the
+	// following operations on them can be planned too.
+	createdRepos map[string]bool
+}
+
+func newPlan() *plan {
+	return &plan{createdRepos: make(map[string]bool)}
+}
+
+func (p *plan) add(a planAction) {
+	logrus.WithFields(logrus.Fields{
+		"action": a.Action,
+		"org":    a.Org,
+		"repo":   a.Repo,
+		"target": a.Target,
+		"detail": a.Detail,
+	}).Info("dry-run")
+
+	p.lock.Lock()
+	p.actions = append(p.actions, a)
+	p.lock.Unlock()
+}
+
+func (p *plan) markCreated(org, repo string) {
+	p.lock.Lock()
+	p.createdRepos[org+"/"+repo] = true
+	p.lock.Unlock()
+}
+
+func (p *plan) isCreated(org, repo string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.createdRepos[org+"/"+repo]
+}
+
+func (p *plan) write(w io.Writer) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	v := struct {
+		GeneratedAt time.Time    `json:"generated_at"`
+		Actions     []planAction `json:"actions"`
+	}{
+		GeneratedAt: time.Now(),
+		Actions:     p.actions,
+	}
+
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// dryRunClient records every write operation into the plan instead of
+// invoking GitHub. The read operations are passed to the real client.
+type dryRunClient struct {
+	iClient
+
+	plan *plan
+}
+
+func newDryRunClient(cli iClient, p *plan) *dryRunClient {
+	return &dryRunClient{iClient: cli, plan: p}
+}
+
+func (d *dryRunClient) SetProtectionBranch(org, repo, branch string, pre *sdk.ProtectionRequest) error {
+	a := planAction{Action: actionProtectBranch, Org: org, Repo: repo, Target: branch}
+	if v := pre.Restrictions; v != nil && len(v.Users) == 0 && len(v.Teams) == 0 {
+		a.Detail = community.BranchReadonly
+	}
+
+	d.plan.add(a)
+	return nil
+}
+
+func (d *dryRunClient) RemoveProtectionBranch(org, repo, branch string) error {
+	d.plan.add(planAction{Action: actionUnprotectBranch, Org: org, Repo: repo, Target: branch})
+	return nil
+}
+
+func (d *dryRunClient) DeleteBranch(org, repo, branch string) error {
+	d.plan.add(planAction{Action: actionDeleteBranch, Org: org, Repo: repo, Target: branch})
+	return nil
+}
+
+func (d *dryRunClient) RenameBranch(org, repo, branch, newName string) error {
+	d.plan.add(planAction{
+		Action: actionRenameBranch, Org: org, Repo: repo, Target: branch, Detail: newName,
+	})
+	return nil
+}
+
+func (d *dryRunClient) CreateTeam(org, name, description string) (*sdk.Team, error) {
+	d.plan.add(planAction{Action: actionCreateTeam, Org: org, Target: name})
+	return &sdk.Team{Name: &name, Slug: sdk.String(teamSlug(name))}, nil
+}
+
+func (d *dryRunClient) AddTeamMember(org, slug, login string) error {
+	d.plan.add(planAction{Action: actionAddTeamMember, Org: org, Target: slug, Detail: login})
+	return nil
+}
+
+func (d *dryRunClient) RemoveTeamMember(org, slug, login string) error {
+	d.plan.add(planAction{Action: actionRemoveTeamMember, Org: org, Target: slug, Detail: login})
+	return nil
+}
+
+func (d *dryRunClient) AddTeamRepo(org, slug, repo, permission string) error {
+	d.plan.add(planAction{Action: actionAddTeamRepo, Org: org, Repo: repo, Target: slug, Detail: permission})
+	return nil
+}
+
+func (d *dryRunClient) RemoveTeamRepo(org, slug, repo string) error {
+	d.plan.add(planAction{Action: actionRemoveTeamRepo, Org: org, Repo: repo, Target: slug})
+	return nil
+}
+
+func (d *dryRunClient) CreateFile(org, repo, path, branch, commitMSG, sha string, content []byte) error {
+	d.plan.add(planAction{
+		Action: actionCreateFile, Org: org, Repo: repo, Target: path,
+		Detail: fmt.Sprintf("branch:%s", branch),
+	})
+	return nil
+}
+
+func (d *dryRunClient) CreateRepo(org string, r *sdk.Repository) error {
+	d.plan.add(planAction{
+		Action: actionCreateRepo, Org: org, Repo: r.GetName(),
+		Detail: fmt.Sprintf("private:%t", r.GetPrivate()),
+	})
+	d.plan.markCreated(org, r.GetName())
+	return nil
+}
+
+func (d *dryRunClient) UpdateRepo(org, repo string, r *sdk.Repository) error {
+	if n := r.GetName(); n != "" && n != repo {
+		d.plan.add(planAction{Action: actionRenameRepo, Org: org, Repo: repo, Target: n})
+		return nil
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	d.plan.add(planAction{Action: actionUpdateRepo, Org: org, Repo: repo, Detail: string(b)})
+	return nil
+}
+
+func (d *dryRunClient) TransferRepo(org, repo, newOrg string) error {
+	d.plan.add(planAction{Action: actionTransferRepo, Org: org, Repo: repo, Target: newOrg})
+	return nil
+}
+
+func (d *dryRunClient) ReplaceTopics(org, repo string, topics []string) error {
+	d.plan.add(planAction{
+		Action: actionReplaceTopics, Org: org, Repo: repo, Detail: strings.Join(topics, ","),
+	})
+	return nil
+}
+
+func (d *dryRunClient) SetInteractionLimit(org, repo, limit, expiry string) (time.Time, error) {
+	d.plan.add(planAction{Action: actionLimitInteraction, Org: org, Repo: repo, Detail: limit})
+	return time.Time{}, nil
+}
+
+func (d *dryRunClient) RemoveInteractionLimit(org, repo string) error {
+	d.plan.add(planAction{Action: actionUnlimitInteraction, Org: org, Repo: repo})
+	return nil
+}
+
+func (d *dryRunClient) GetRef(org, repo, ref string) (*sdk.Reference, error) {
+	if d.plan.isCreated(org, repo) {
+		return &sdk.Reference{
+			Ref:    sdk.String(ref),
+			Object: &sdk.GitObject{SHA: sdk.String("dry-run")},
+		}, nil
+	}
+
+	return d.iClient.GetRef(org, repo, ref)
+}
+
+func (d *dryRunClient) CreateBranch(org, repo string, reference *sdk.Reference) error {
+	d.plan.add(planAction{Action: actionCreateBranch, Org: org, Repo: repo, Target: reference.GetRef()})
+	return nil
+}
+
+func (d *dryRunClient) RemoveRepoMember(pr gc.PRInfo, login string) error {
+	d.plan.add(planAction{Action: actionRemoveCollaborator, Org: pr.Org, Repo: pr.Repo, Target: login})
+	return nil
+}
+
+func (d *dryRunClient) AddRepoMember(pr gc.PRInfo, login, permission string) error {
+	action := actionAddCollaborator
+	if permission == "maintain" {
+		action = actionPromoteMaintain
+	}
+
+	d.plan.add(planAction{
+		Action: action, Org: pr.Org, Repo: pr.Repo, Target: login,
+		Detail: fmt.Sprintf("permission:%s", permission),
+	})
+	return nil
+}
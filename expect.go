@@ -1,16 +1,15 @@
 package main
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
-	gesdk "github.com/opensourceways/go-gitee/gitee"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/yaml"
@@ -24,7 +23,7 @@ type watchingFileObject interface {
 
 type watchingFile struct {
 	log      *logrus.Entry
-	loadFile func(string) (string, string, error)
+	loadFile func(string) ([]byte, string, error)
 
 	file string
 	sha  string
@@ -107,11 +106,10 @@ func (e *expectSigInfos) refresh(f getSHAFunc) *community.SigInfos {
 type expectState struct {
 	log    *logrus.Entry
 	cli    iClient
-	gecli  geClient
+	src    communitySource
 	w      repoBranch
 	sigDir string
 
-	tree      []gesdk.TreeBasic
 	reposInfo *community.Repos
 	repos     map[string]*expectRepos
 	sigOwners map[string]*expectSigOwners
@@ -120,26 +118,36 @@ type expectState struct {
 }
 
 func (e *expectState) init(orgPath, sigFilePath, sigDir string) (string, error) {
-	// call Gitee API to get Tree
-	trees, err := e.gecli.GetDirectoryTree(e.w.Org, e.w.Repo, e.w.Branch, 1)
-	if err != nil || len(trees.Tree) == 0 {
+	files, err := e.src.listFiles()
+	if err != nil {
 		return "", err
 	}
-	e.tree = trees.Tree
+	if len(files) == 0 {
+		return "", fmt.Errorf("empty tree of %s/%s/%s", e.w.Org, e.w.Repo, e.w.Branch)
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
 
 	reposInfo := new(community.Repos)
 	e.repos = make(map[string]*expectRepos)
-	for _, v := range e.tree {
-		patharr := strings.Split(v.Path, "/")
-		if patharr[0] != "sig" || len(patharr) != 5 || patharr[2] != orgPath {
+	for _, p := range paths {
+		if _, _, ok := parseRepoFile(p, sigDir, orgPath); !ok {
 			continue
 		}
 
-		exRepo := &expectRepos{e.newWatchingFile(v.Path)}
-		e.repos[v.Path] = exRepo
+		exRepo := &expectRepos{e.newWatchingFile(p)}
+		e.repos[p] = exRepo
 		singleRepo := exRepo.refresh(func(string) string {
 			return "init"
 		})
+		if singleRepo == nil {
+			continue
+		}
+
 		reposInfo.Repositories = append(reposInfo.Repositories, *singleRepo)
 	}
 	reposInfo.Validate()
@@ -155,27 +163,25 @@ func (e *expectState) init(orgPath, sigFilePath, sigDir string) (string, error)
 	return org, nil
 }
 
-// Packages means a slice of repos these are needed to create, example: [{vwh50  openEuler:Factory 2023-03-31}]
-// OneCheckTotalRepos means an int number of all repos these are needed to create, example: 1
-var Packages []PackageInfo
-var OneCheckTotalRepos int
+// sigRecycle is the sig which the repos no longer maintained are moved to.
+const sigRecycle = "sig-recycle"
 
+// check checks all the repos. The repos of sig-recycle are checked without roles.
+// It returns error if the expected state can't be loaded.
 func (e *expectState) check(
 	org string,
 	isStopped func() bool,
-	clearLocal func(func(string) bool),
-	checkRepo func(*community.Repository, []string, []string, string, *logrus.Entry),
-) {
-
-	// 测试将单次创建仓库对应的单次更新文件，修改为一批次创建仓库对应一次更新文件, 每次轮询check时，进行重置
-	Packages = []PackageInfo{}
-	OneCheckTotalRepos = 0
+	clearLocal func(isExpectedRepo, isRenamedRepo func(string) bool),
+	filter func(repo, sig string) bool,
+	checkRepo func(*community.Repository, *repoRoles, string, *logrus.Entry),
+) error {
+	if filter == nil {
+		filter = func(string, string) bool { return true }
+	}
 
 	allFiles, allSigs, allSigInfos, err := e.listAllFilesOfRepo(org)
 	if err != nil {
-		e.log.Errorf("list all file, err:%s", err.Error())
-
-		return
+		return fmt.Errorf("list all file, err:%s", err.Error())
 	}
 	getSHA := func(p string) string {
 		return allFiles[p]
@@ -187,9 +193,7 @@ func (e *expectState) check(
 		expState := e.getRepoFile(i)
 		singleRepo := expState.refresh(getSHA)
 
-		path := strings.Split(i, ".yaml")[0]
-		pathArr := strings.Split(path, "/")
-		repoName := pathArr[4]
+		sig, repoName, _ := parseRepoFile(i, e.sigDir, org)
 
 		//if repofile name is not same with the Name in the file.
 		if singleRepo.Name != repoName {
@@ -197,7 +201,7 @@ func (e *expectState) check(
 			continue
 		}
 
-		repoSigsInfo[repoName] = pathArr[1]
+		repoSigsInfo[repoName] = sig
 
 		for i := 0; i < len(e.reposInfo.Repositories); i++ {
 			if e.reposInfo.Repositories[i].Name == repoName {
@@ -213,9 +217,7 @@ func (e *expectState) check(
 	for _, key := range e.reposInfo.Repositories {
 		hasSameRepo := false
 		for i := range allFiles {
-			path := strings.Split(i, ".yaml")[0]
-			repoName := strings.Split(path, "/")[4]
-			if key.Name == repoName {
+			if _, repoName, _ := parseRepoFile(i, e.sigDir, org); key.Name == repoName {
 				hasSameRepo = true
 				break
 			}
@@ -237,14 +239,21 @@ func (e *expectState) check(
 
 	if len(repoMap) == 0 {
 		// keep safe to do this. it is impossible to happen generally.
-		e.log.Warning("there are not repos. Impossible!!!")
-		return
+		return fmt.Errorf("there are not repos. Impossible!!!")
+	}
+
+	// the old names of the renamed repos are not orphans.
+	renamed := sets.NewString()
+	for _, v := range repoMap {
+		if v.RenameFrom != "" {
+			renamed.Insert(v.RenameFrom)
+		}
 	}
 
 	clearLocal(func(r string) bool {
 		_, ok := repoMap[r]
 		return ok
-	})
+	}, renamed.Has)
 	getSigSHA := func(p string) string {
 		return allSigs[p]
 	}
@@ -258,7 +267,7 @@ func (e *expectState) check(
 	done := sets.NewString()
 	for repo := range repoSigsInfo {
 		sigName := repoSigsInfo[repo]
-		if sigName == "sig-recycle" {
+		if sigName == sigRecycle || !filter(repo, sigName) {
 			continue
 		}
 
@@ -276,14 +285,21 @@ func (e *expectState) check(
 			info := sigInfo.refresh(getSigInfoSHA)
 			repoAdmin := info.GetRepoAdmin()
 			repoOwners := info.GetRepoAdditionalOwners()
+			repoContributors := info.GetRepoContributors()
 			rawOwners = info.GetRepoOwners()
 			admins := make([]string, 0)
 			additionalOwners := make([]string, 0)
+			contributors := make([]string, 0)
 
+			sigAdmins := sets.NewString()
 			for k := range repoAdmin {
 				if strings.Split(k, "/")[0] == org && strings.Split(k, "/")[1] == repo {
 					admins = repoAdmin[k]
 				}
+
+				if strings.Split(k, "/")[0] == org {
+					sigAdmins.Insert(repoAdmin[k]...)
+				}
 			}
 
 			for k := range repoOwners {
@@ -292,6 +308,12 @@ func (e *expectState) check(
 				}
 			}
 
+			for k := range repoContributors {
+				if strings.Split(k, "/")[0] == org && strings.Split(k, "/")[1] == repo {
+					contributors = repoContributors[k]
+				}
+			}
+
 			if isStopped() {
 				break
 			}
@@ -300,15 +322,24 @@ func (e *expectState) check(
 				continue
 			}
 
+			roles := &repoRoles{
+				maintainers:  rawOwners,
+				committers:   additionalOwners,
+				contributors: contributors,
+				admins:       admins,
+				sigAdmins:    sigAdmins.List(),
+			}
+
 			if len(additionalOwners) > 0 {
-				allOwners := append(rawOwners, additionalOwners...)
-				ownersOfSigs[sigName] = allOwners
-				checkRepo(repoMap[repo], allOwners, admins, sigName, e.log)
+				allOwners := make([]string, 0, len(rawOwners)+len(additionalOwners))
+				allOwners = append(allOwners, rawOwners...)
+				ownersOfSigs[sigName] = append(allOwners, additionalOwners...)
 			} else {
 				ownersOfSigs[sigName] = rawOwners
-				checkRepo(repoMap[repo], rawOwners, admins, sigName, e.log)
 			}
 
+			checkRepo(repoMap[repo], roles, sigName, e.log)
+
 			done.Insert(repo)
 		} else {
 			if isStopped() {
@@ -319,7 +350,7 @@ func (e *expectState) check(
 				continue
 			}
 
-			checkRepo(repoMap[repo], owners.GetOwners(), nil, sigName, e.log)
+			checkRepo(repoMap[repo], &repoRoles{maintainers: owners.GetOwners()}, sigName, e.log)
 
 			done.Insert(repo)
 		}
@@ -328,7 +359,7 @@ func (e *expectState) check(
 	writeToLog(&allFiles, &allSigs, &repoSigsInfo, &repoMap, &ownersOfSigs)
 
 	if len(repoMap) == done.Len() {
-		return
+		return nil
 	}
 
 	for repo := range repoSigsInfo {
@@ -338,7 +369,7 @@ func (e *expectState) check(
 
 		if !done.Has(repo) {
 			sigName := repoSigsInfo[repo]
-			if sigName == "sig-recycle" {
+			if !filter(repo, sigName) {
 				continue
 			}
 
@@ -346,9 +377,11 @@ func (e *expectState) check(
 				continue
 			}
 
-			checkRepo(repoMap[repo], nil, nil, sigName, e.log)
+			checkRepo(repoMap[repo], &repoRoles{}, sigName, e.log)
 		}
 	}
+
+	return nil
 }
 
 func (e *expectState) getSigOwner(sigName string) *expectSigOwners {
@@ -356,7 +389,7 @@ func (e *expectState) getSigOwner(sigName string) *expectSigOwners {
 	if !ok {
 		o = &expectSigOwners{
 			wf: e.newWatchingFile(
-				path.Join(e.sigDir, sigName, "OWNERS"),
+				path.Join(e.sigDir, sigName, sigOwnersFile),
 			),
 		}
 		e.sigOwners[sigName] = o
@@ -383,7 +416,7 @@ func (e *expectState) getSigInfo(sigName string) *expectSigInfos {
 	if !ok {
 		o = &expectSigInfos{
 			wf: e.newWatchingFile(
-				path.Join(e.sigDir, sigName, "sig-info.yaml"),
+				path.Join(e.sigDir, sigName, sigInfoFile),
 			),
 		}
 
@@ -397,63 +430,76 @@ func (e *expectState) newWatchingFile(p string) watchingFile {
 	return watchingFile{
 		file:     p,
 		log:      e.log,
-		loadFile: e.loadFile,
+		loadFile: e.src.loadFile,
 	}
 }
 
 func (e *expectState) listAllFilesOfRepo(org string) (map[string]string, map[string]string, map[string]string, error) {
-	trees, err := e.gecli.GetDirectoryTree(e.w.Org, e.w.Repo, e.w.Branch, 1)
-	if err != nil || len(trees.Tree) == 0 {
+	files, err := e.src.listFiles()
+	if err != nil || len(files) == 0 {
 		return nil, nil, nil, err
 	}
 
 	r := make(map[string]string)
 	s := make(map[string]string)
 	q := make(map[string]string)
-	for i := range trees.Tree {
-		item := &trees.Tree[i]
-		patharr := strings.Split(item.Path, "/")
-		if len(patharr) == 0 {
-			continue
-		}
-		if patharr[0] == "sig" && len(patharr) == 5 && patharr[2] == org {
-			form := strings.Split(patharr[4], ".yaml")
-			if len(form) != 2 || form[1] != "" {
-				continue
-			}
-			r[item.Path] = item.Sha
-			continue
-		}
-		if patharr[0] == "sig" && len(patharr) == 3 && patharr[2] == "OWNERS" {
-			s[item.Path] = item.Sha
+	for p, sha := range files {
+		if _, _, ok := parseRepoFile(p, e.sigDir, org); ok {
+			r[p] = sha
 			continue
 		}
 
-		if patharr[0] == "sig" && len(patharr) == 3 && patharr[2] == "sig-info.yaml" {
-			q[item.Path] = item.Sha
-			continue
+		switch _, name, _ := parseSigFile(p, e.sigDir); name {
+		case sigOwnersFile:
+			s[p] = sha
+		case sigInfoFile:
+			q[p] = sha
 		}
 	}
 
 	return r, s, q, nil
 }
 
-func (e *expectState) loadFile(f string) (string, string, error) {
-	c, err := e.gecli.GetPathContent(e.w.Org, e.w.Repo, f, e.w.Branch)
-	if err != nil {
-		return "", "", err
+const (
+	sigOwnersFile = "OWNERS"
+	sigInfoFile   = "sig-info.yaml"
+)
+
+// splitSigPath splits the path of file under the sigDir into the items after sigDir.
+// It returns nil if the file is not under the sigDir.
+func splitSigPath(p, sigDir string) []string {
+	prefix := strings.TrimSuffix(sigDir, "/") + "/"
+	if !strings.HasPrefix(p, prefix) {
+		return nil
 	}
 
-	return c.Content, c.Sha, nil
+	return strings.Split(strings.TrimPrefix(p, prefix), "/")
 }
 
-func decodeYamlFile(content string, v interface{}) error {
-	c, err := base64.StdEncoding.DecodeString(content)
-	if err != nil {
-		return err
+// parseRepoFile returns the sig and repo of the repo file of org, which is at
+// <sigDir>/<sig>/<org>/<x>/<repo>.yaml
+func parseRepoFile(p, sigDir, org string) (sig, repo string, ok bool) {
+	items := splitSigPath(p, sigDir)
+	if len(items) != 4 || items[1] != org || !strings.HasSuffix(items[3], ".yaml") {
+		return
+	}
+
+	return items[0], strings.TrimSuffix(items[3], ".yaml"), true
+}
+
+// parseSigFile returns the sig and name of the file of sig owners, which is at
+// <sigDir>/<sig>/OWNERS or <sigDir>/<sig>/sig-info.yaml
+func parseSigFile(p, sigDir string) (sig, name string, ok bool) {
+	items := splitSigPath(p, sigDir)
+	if len(items) != 2 || (items[1] != sigOwnersFile && items[1] != sigInfoFile) {
+		return
 	}
 
-	return yaml.Unmarshal(c, v)
+	return items[0], items[1], true
+}
+
+func decodeYamlFile(content []byte, v interface{}) error {
+	return yaml.Unmarshal(content, v)
 }
 
 func writeToLog(
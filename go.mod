@@ -8,7 +8,9 @@ require (
 	github.com/opensourceways/community-robot-lib v0.0.0-20220714092941-48ee37a417d1
 	github.com/opensourceways/go-gitee v0.0.0-20220714075315-cb246f1dfb96
 	github.com/panjf2000/ants/v2 v2.4.6
+	github.com/prometheus/client_golang v1.12.2
 	github.com/sirupsen/logrus v1.8.1
+	golang.org/x/oauth2 v0.0.0-20220411215720-9780585627b5
 	gopkg.in/yaml.v3 v3.0.1
 	k8s.io/apimachinery v0.24.0
 	sigs.k8s.io/yaml v1.3.0
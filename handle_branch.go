@@ -2,18 +2,27 @@ package main
 
 import (
 	"fmt"
+	"time"
+
 	sdk "github.com/google/go-github/v36/github"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/models"
 )
 
+// handleBranch makes the branches of repo be the declared ones. The protection rules are
+// compared with the live ones if refresh is true, and it returns true as the last value
+// only if all of them have been fetched.
 func (bot *robot) handleBranch(
 	expectRepo expectRepoInfo,
 	localBranches []community.RepoBranch,
+	undeclared map[string]time.Time,
+	defaultBranch string,
+	refresh bool,
 	log *logrus.Entry,
-) []community.RepoBranch {
+) ([]community.RepoBranch, map[string]time.Time, bool) {
 	org := expectRepo.org
 	repo := expectRepo.getNewRepoName()
 
@@ -21,7 +30,7 @@ func (bot *robot) handleBranch(
 		v, err := bot.listAllBranchOfRepo(org, repo)
 		if err != nil {
 			log.Errorf("handle branch and list all branch of repo:%s, err:%s", repo, err.Error())
-			return nil
+			return nil, undeclared, false
 		}
 		localBranches = v
 	}
@@ -29,25 +38,27 @@ func (bot *robot) handleBranch(
 	bsExpect := genBranchSets(expectRepo.expectRepoState.Branches)
 	bsLocal := genBranchSets(localBranches)
 	newState := []community.RepoBranch{}
+	refreshed := refresh
 
 	// update
 	if v := bsExpect.intersectionByName(&bsLocal); len(v) > 0 {
 		for name := range v {
-			eb := bsExpect.get(name)
+			eb := bot.expectBranch(expectRepo, bsExpect.get(name))
 			lb := bsLocal.get(name)
-			if eb.Type != lb.Type {
-				if eb.Type == "readonly" {
-					newState = append(newState, *eb)
-					continue
-				}
+			if eb.IsProtected() && lb.IsProtected() {
+				b, ok := bot.syncBranchProtection(org, repo, lb, &eb, refresh, log)
+				newState = append(newState, b)
+				refreshed = refreshed && ok
+				continue
+			}
+
+			if eb.IsProtected() != lb.IsProtected() {
 				l := log.WithField("update branch", fmt.Sprintf("%s/%s", repo, name))
 				l.Info("start")
 
-				err := bot.updateBranch(
-					org, repo, name, eb.Type == community.BranchProtected,
-				)
+				err := bot.updateBranch(org, repo, &eb)
 				if err == nil {
-					newState = append(newState, *eb)
+					newState = append(newState, eb)
 					continue
 				} else {
 					l.WithField("type", eb.Type).Error(err)
@@ -59,24 +70,154 @@ func (bot *robot) handleBranch(
 
 	// add new
 	if v := bsExpect.differenceByName(&bsLocal); len(v) > 0 {
-		for _, item := range v {
-			if b, ok := bot.createBranch(org, repo, item, log); ok {
+		for i := range v {
+			b, ok := bot.createBranch(org, repo, bot.expectBranch(expectRepo, &v[i]), defaultBranch, log)
+			if ok {
 				newState = append(newState, b)
 			}
 		}
 	}
 
-	return newState
+	// undeclared
+	if v := bsLocal.differenceByName(&bsExpect); len(v) > 0 {
+		b, u := bot.handleUndeclaredBranch(org, repo, v, undeclared, log)
+
+		return append(newState, b...), u, refreshed
+	}
+
+	return newState, nil, refreshed
 }
 
+// handleUndeclaredBranch applies the policy of org to the branches which are not declared.
+// It returns the branches which still exist and the ones waiting to be deleted. The
+// branches are dropped from the state if there is no policy.
+func (bot *robot) handleUndeclaredBranch(
+	org, repo string,
+	branches []community.RepoBranch,
+	undeclared map[string]time.Time,
+	log *logrus.Entry,
+) ([]community.RepoBranch, map[string]time.Time) {
+	policy := bot.cfg.UndeclaredBranch[org]
+	if policy.isNone() {
+		return nil, nil
+	}
+
+	defaultBranch := ""
+	// the default branch and the branches which have open pull requests are never touched.
+	isReserved := func(branch string) (bool, error) {
+		if defaultBranch == "" {
+			v, err := bot.cli.GetRepo(org, repo)
+			if err != nil {
+				return true, err
+			}
+			defaultBranch = v.GetDefaultBranch()
+		}
+
+		if branch == defaultBranch {
+			return true, nil
+		}
+
+		return bot.cli.HasOpenPR(org, repo, branch)
+	}
+
+	now := time.Now()
+	kept := make([]community.RepoBranch, 0, len(branches))
+	pending := make(map[string]time.Time)
+
+	for i := range branches {
+		b := branches[i]
+
+		if policy.Action == undeclaredBranchUnprotect && !b.IsProtected() {
+			kept = append(kept, b)
+			continue
+		}
+
+		since, ok := undeclared[b.Name]
+		if !ok {
+			since = now
+		}
+
+		l := log.WithField(policy.Action+" undeclared branch", fmt.Sprintf("%s/%s", repo, b.Name))
+
+		// the reserved branch is not pending, so that the grace period starts again
+		// after it is no longer reserved.
+		if reserved, err := isReserved(b.Name); err != nil || reserved {
+			if err != nil {
+				l.Error(err)
+
+				// keep the time found not declared if it is unknown whether the
+				// branch is reserved.
+				if ok && policy.Action == undeclaredBranchDelete {
+					pending[b.Name] = since
+				}
+			}
+
+			kept = append(kept, b)
+			continue
+		}
+
+		if policy.Action == undeclaredBranchDelete && now.Sub(since) < policy.gracePeriod() {
+			pending[b.Name] = since
+			kept = append(kept, b)
+			continue
+		}
+
+		l.Info("start")
+
+		if policy.Action == undeclaredBranchUnprotect {
+			if err := bot.cli.RemoveProtectionBranch(org, repo, b.Name); err != nil {
+				l.Error(err)
+			} else {
+				b.Type = ""
+				b.Protection = nil
+			}
+
+			kept = append(kept, b)
+			continue
+		}
+
+		if err := bot.deleteBranch(org, repo, &b); err != nil {
+			l.Error(err)
+
+			pending[b.Name] = since
+			kept = append(kept, b)
+		}
+	}
+
+	return kept, pending
+}
+
+func (bot *robot) deleteBranch(org, repo string, branch *community.RepoBranch) error {
+	if branch.IsProtected() {
+		if err := bot.cli.RemoveProtectionBranch(org, repo, branch.Name); err != nil {
+			return err
+		}
+
+		branch.Type = ""
+		branch.Protection = nil
+	}
+
+	if err := bot.cli.DeleteBranch(org, repo, branch.Name); err != nil {
+		return err
+	}
+
+	recordChange(changeBranchDeleted)
+	return nil
+}
+
+// createBranch creates the branch from the default branch of repo if CreateFrom is not set.
+// The default branch is regarded as "master" if it is unknown.
 func (bot *robot) createBranch(
 	org, repo string,
 	branch community.RepoBranch,
+	defaultBranch string,
 	log *logrus.Entry,
 ) (community.RepoBranch, bool) {
 	ref := branch.CreateFrom
 	if ref == "" {
-		// ref must be passed according to the gitee api and the default value is "master"
+		ref = defaultBranch
+	}
+	if ref == "" {
 		ref = community.BranchMaster
 	}
 
@@ -94,10 +235,12 @@ func (bot *robot) createBranch(
 			log.WithField("CreateFrom", ref).Error(err)
 			return community.RepoBranch{}, false
 		}
+	} else {
+		recordChange(changeBranchCreated)
 	}
 
-	if branch.Type == community.BranchProtected {
-		if err := bot.cli.SetProtectionBranch(org, repo, branch.Name, &sdk.ProtectionRequest{}); err != nil {
+	if branch.IsProtected() {
+		if err := bot.cli.SetProtectionBranch(org, repo, branch.Name, toProtectionRequest(&branch)); err != nil {
 			log.Errorf("set the branch to be protected, err:%s", err.Error())
 
 			return community.RepoBranch{
@@ -105,16 +248,274 @@ func (bot *robot) createBranch(
 				CreateFrom: ref,
 			}, true
 		}
+
+		recordChange(changeBranchProtected)
 	}
 
 	return branch, true
 }
 
-func (bot *robot) updateBranch(org, repo, branch string, protected bool) error {
-	if protected {
-		return bot.cli.SetProtectionBranch(org, repo, branch, &sdk.ProtectionRequest{})
+// handleDefaultBranch makes the default branch of repo be the expected one if it exists.
+// The default branch of the existing repo is never renamed, because the current one may
+// be used by others. Only the newly created repo is renamed, see initDefaultBranch. It
+// warns only once if the expected branch doesn't exist.
+func (bot *robot) handleDefaultBranch(
+	expectRepo expectRepoInfo,
+	lp *models.RepoProperty,
+	branches []community.RepoBranch,
+	log *logrus.Entry,
+) []community.RepoBranch {
+	org := expectRepo.org
+	repo := expectRepo.getNewRepoName()
+
+	expect := bot.cfg.repoSettings(org, expectRepo.expectRepoState).DefaultBranch
+	if expect == "" || expect == lp.Settings.DefaultBranch {
+		lp.MissingDefaultBranch = ""
+		return branches
+	}
+
+	// it has been found missing, and is checked again after it is created.
+	bs := genBranchSets(branches)
+	if lp.MissingDefaultBranch == expect && bs.get(expect) == nil {
+		return branches
+	}
+
+	current := lp.Settings.DefaultBranch
+	if current == "" {
+		v, err := bot.cli.GetRepo(org, repo)
+		if err != nil {
+			log.Errorf("get the default branch of repo:%s, err:%s", repo, err.Error())
+			return branches
+		}
+
+		if current = v.GetDefaultBranch(); current == expect {
+			lp.Settings.DefaultBranch = current
+			return branches
+		}
+	}
+
+	log = log.WithField("update default branch", fmt.Sprintf("%s: from %s to %s", repo, current, expect))
+
+	live, err := bot.listAllBranchOfRepo(org, repo)
+	if err != nil {
+		log.Errorf("list branch, err:%s", err.Error())
+		return branches
+	}
+
+	if lbs := genBranchSets(live); lbs.get(expect) == nil {
+		log.Warningf("the branch:%s doesn't exist", expect)
+		lp.MissingDefaultBranch = expect
+		return branches
+	}
+
+	log.Info("start")
+
+	if err := bot.cli.UpdateRepo(org, repo, &sdk.Repository{Name: &repo, DefaultBranch: &expect}); err != nil {
+		log.Error(err)
+		return branches
 	}
-	return bot.cli.RemoveProtectionBranch(org, repo, branch)
+
+	lp.Settings.DefaultBranch = expect
+	lp.MissingDefaultBranch = ""
+	recordChange(changeDefaultBranch)
+
+	return branches
+}
+
+// initDefaultBranch renames the default branch of the newly created repo to the expected one
+// if it is set, and returns the default branch.
+func (bot *robot) initDefaultBranch(org, repo, expect string, log *logrus.Entry) string {
+	// the repo is not created in dry-run mode.
+	if bot.plan != nil {
+		if expect != "" {
+			return expect
+		}
+		return community.BranchMaster
+	}
+
+	v, err := bot.cli.GetRepo(org, repo)
+	if err != nil {
+		log.Errorf("get the default branch of repo:%s, err:%s", repo, err.Error())
+
+		if expect != "" {
+			return expect
+		}
+		return community.BranchMaster
+	}
+
+	current := v.GetDefaultBranch()
+	if expect == "" || expect == current {
+		return current
+	}
+
+	if err := bot.cli.RenameBranch(org, repo, current, expect); err != nil {
+		log.WithField("rename default branch", fmt.Sprintf("%s: from %s to %s", repo, current, expect)).Error(err)
+
+		return current
+	}
+
+	recordChange(changeBranchRenamed)
+
+	return expect
+}
+
+// expectBranch returns a copy of branch including the protection rules which will
+// be applied to it. The rules declared by the branch precede the ones of config.
+// A readonly branch only enforces the rules on admins, and nobody can push to it.
+func (bot *robot) expectBranch(expectRepo expectRepoInfo, branch *community.RepoBranch) community.RepoBranch {
+	b := *branch
+
+	switch b.Type {
+	case community.BranchReadonly:
+		b.Protection = &community.BranchProtection{EnforceAdmins: true}
+	case community.BranchProtected:
+		if b.Protection == nil {
+			b.Protection = bot.cfg.BranchProtection.get(expectRepo.sig)
+		}
+	default:
+		b.Protection = nil
+	}
+
+	return b
+}
+
+// updateBranch protects the branch with its rules, or unprotects it if it is not a protected one.
+func (bot *robot) updateBranch(org, repo string, branch *community.RepoBranch) error {
+	if branch.IsProtected() {
+		err := bot.cli.SetProtectionBranch(org, repo, branch.Name, toProtectionRequest(branch))
+		if err == nil {
+			recordChange(changeBranchProtected)
+		}
+		return err
+	}
+	return bot.cli.RemoveProtectionBranch(org, repo, branch.Name)
+}
+
+// syncBranchProtection makes the type and protection rules of the protected branch be the
+// expected ones. The live rules are fetched when the local ones are unknown or different
+// from the expected ones, or when refresh is true, so that the drift on GitHub is reverted.
+// It returns false if failed to fetch the live rules.
+func (bot *robot) syncBranchProtection(
+	org, repo string,
+	local *community.RepoBranch,
+	expect *community.RepoBranch,
+	refresh bool,
+	log *logrus.Entry,
+) (community.RepoBranch, bool) {
+	b := *local
+	if !refresh && isSameProtection(&b, expect) {
+		return b, true
+	}
+
+	log = log.WithField("update branch protection", fmt.Sprintf("%s/%s", repo, b.Name))
+
+	v, err := bot.cli.GetBranchProtection(org, repo, b.Name)
+	if err != nil {
+		log.Errorf("get the protection, err:%s", err.Error())
+		return b, false
+	}
+
+	if v != nil {
+		b.Type, b.Protection = toBranchProtection(v)
+		if isSameProtection(&b, expect) {
+			return b, true
+		}
+	}
+
+	log.WithField("type", expect.Type).Info("start")
+
+	if err := bot.updateBranch(org, repo, expect); err != nil {
+		log.Error(err)
+		return b, true
+	}
+
+	b.Type = expect.Type
+	b.Protection = expect.Protection
+	return b, true
+}
+
+func isSameProtection(b, b1 *community.RepoBranch) bool {
+	return b.Type == b1.Type && b.Protection != nil && b.Protection.Equal(b1.Protection)
+}
+
+func toProtectionRequest(b *community.RepoBranch) *sdk.ProtectionRequest {
+	r := &sdk.ProtectionRequest{}
+
+	if b.Type == community.BranchReadonly {
+		// nobody is allowed to push
+		r.Restrictions = &sdk.BranchRestrictionsRequest{
+			Users: []string{},
+			Teams: []string{},
+		}
+	}
+
+	p := b.Protection
+	if p == nil {
+		return r
+	}
+
+	r.EnforceAdmins = p.EnforceAdmins
+
+	if p.RequiredReviews > 0 || p.DismissStaleReviews {
+		r.RequiredPullRequestReviews = &sdk.PullRequestReviewsEnforcementRequest{
+			DismissStaleReviews:          p.DismissStaleReviews,
+			RequiredApprovingReviewCount: p.RequiredReviews,
+		}
+	}
+
+	if len(p.RequiredStatusChecks) > 0 || p.StrictStatusChecks {
+		contexts := p.RequiredStatusChecks
+		if contexts == nil {
+			contexts = []string{}
+		}
+
+		r.RequiredStatusChecks = &sdk.RequiredStatusChecks{
+			Strict:   p.StrictStatusChecks,
+			Contexts: contexts,
+		}
+	}
+
+	if len(p.PushTeams) > 0 && r.Restrictions == nil {
+		r.Restrictions = &sdk.BranchRestrictionsRequest{
+			Users: []string{},
+			Teams: p.PushTeams,
+		}
+	}
+
+	return r
+}
+
+// toBranchProtection returns the type and rules of a protected branch. It is a readonly
+// branch if the pushers are restricted to nobody.
+func toBranchProtection(p *sdk.Protection) (string, *community.BranchProtection) {
+	r := &community.BranchProtection{}
+	t := community.BranchProtected
+
+	if v := p.RequiredPullRequestReviews; v != nil {
+		r.RequiredReviews = v.RequiredApprovingReviewCount
+		r.DismissStaleReviews = v.DismissStaleReviews
+	}
+
+	if v := p.RequiredStatusChecks; v != nil {
+		r.RequiredStatusChecks = v.Contexts
+		r.StrictStatusChecks = v.Strict
+	}
+
+	if v := p.EnforceAdmins; v != nil {
+		r.EnforceAdmins = v.Enabled
+	}
+
+	if v := p.Restrictions; v != nil {
+		if len(v.Users) == 0 && len(v.Teams) == 0 && len(v.Apps) == 0 {
+			t = community.BranchReadonly
+		}
+
+		for _, item := range v.Teams {
+			r.PushTeams = append(r.PushTeams, item.GetSlug())
+		}
+	}
+
+	return t, r
 }
 
 func (bot *robot) listAllBranchOfRepo(org, repo string) ([]community.RepoBranch, error) {
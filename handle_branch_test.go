@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	sdk "github.com/google/go-github/v36/github"
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
+)
+
+type branchClient struct {
+	iClient
+
+	openPRs map[string]bool
+	deleted []string
+}
+
+func (c *branchClient) GetRepo(org, repo string) (*sdk.Repository, error) {
+	b := "master"
+	return &sdk.Repository{DefaultBranch: &b}, nil
+}
+
+func (c *branchClient) HasOpenPR(org, repo, branch string) (bool, error) {
+	return c.openPRs[branch], nil
+}
+
+func (c *branchClient) RemoveProtectionBranch(org, repo, branch string) error {
+	return nil
+}
+
+func (c *branchClient) DeleteBranch(org, repo, branch string) error {
+	c.deleted = append(c.deleted, branch)
+	return nil
+}
+
+func TestHandleUndeclaredBranch(t *testing.T) {
+	cli := &branchClient{openPRs: map[string]bool{"busy": true}}
+	bot := robot{
+		cli: cli,
+		cfg: &botConfig{
+			UndeclaredBranch: map[string]undeclaredBranchPolicy{
+				"src-openeuler": {Action: undeclaredBranchDelete, GracePeriod: 60},
+			},
+		},
+	}
+
+	branches := []community.RepoBranch{
+		{Name: "master"},
+		{Name: "busy"},
+		{Name: "new"},
+		{Name: "old", Type: community.BranchProtected},
+	}
+	undeclared := map[string]time.Time{
+		"master": time.Now().Add(-2 * time.Hour),
+		"busy":   time.Now().Add(-2 * time.Hour),
+		"old":    time.Now().Add(-2 * time.Hour),
+	}
+
+	kept, pending := bot.handleUndeclaredBranch(
+		"src-openeuler", "test", branches, undeclared, logrus.NewEntry(logrus.New()),
+	)
+
+	if len(cli.deleted) != 1 || cli.deleted[0] != "old" {
+		t.Errorf("unexpected deleted branches: %v", cli.deleted)
+	}
+
+	if len(kept) != 3 {
+		t.Errorf("unexpected kept branches: %v", kept)
+	}
+
+	if _, ok := pending["new"]; !ok || len(pending) != 1 {
+		t.Errorf("unexpected pending branches: %v", pending)
+	}
+
+	kept, pending = bot.handleUndeclaredBranch(
+		"openeuler", "test", branches, undeclared, logrus.NewEntry(logrus.New()),
+	)
+	if kept != nil || pending != nil {
+		t.Errorf("branches should be dropped if there is no policy")
+	}
+}
@@ -5,76 +5,157 @@ import (
 	gc "github.com/opensourceways/community-robot-lib/githubclient"
 	"strings"
 
+	sdk "github.com/google/go-github/v36/github"
 	"github.com/sirupsen/logrus"
-	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
 )
 
-func (bot *robot) handleMember(expectRepo expectRepoInfo, localMembers, localAdmins []string, repoOwner *string, log *logrus.Entry) ([]string, []string) {
+const (
+	permissionPull     = "pull"
+	permissionTriage   = "triage"
+	permissionPush     = "push"
+	permissionMaintain = "maintain"
+	permissionAdmin    = "admin"
+
+	ciBot = "openeuler-ci-bot"
+)
+
+var permissionLevels = map[string]int{
+	permissionPull:     1,
+	permissionTriage:   2,
+	permissionPush:     3,
+	permissionMaintain: 4,
+	permissionAdmin:    5,
+}
+
+func higherPermission(p1, p2 string) string {
+	if permissionLevels[p1] >= permissionLevels[p2] {
+		return p1
+	}
+	return p2
+}
+
+// repoRoles includes the gitee ids of each role of a repo.
+type repoRoles struct {
+	maintainers  []string
+	committers   []string
+	contributors []string
+	admins       []string
+
+	// sigAdmins is the admins of all the repos of sig. It is used by the admin team of sig.
+	sigAdmins []string
+}
+
+// expectMembers maps the roles of repo and the members declared in the repository
+// file to GitHub collaborators. The highest permission wins if a member has more
+// than one role. It returns the owners, the admins and the permissions of all the
+// collaborators. The maintainers and admins are not collaborators if they are
+// managed by the teams of sig.
+func (bot *robot) expectMembers(repo *community.Repository, roles *repoRoles) ([]string, []string, map[string]string) {
+	r := make(map[string]string)
+
+	toLogins := func(ids []string) []string {
+		if len(ids) == 0 {
+			return nil
+		}
+
+		logins, unmapped := bot.mapGiteeIds(ids)
+		bot.unmapped.add(repo.Name, unmapped...)
+
+		return logins
+	}
+
+	grant := func(logins []string, permission string) {
+		if permission == "" {
+			return
+		}
+
+		for _, k := range logins {
+			k = strings.ToLower(k)
+			r[k] = higherPermission(r[k], permission)
+		}
+	}
+
+	p := &bot.cfg.Permissions
+	t := &bot.cfg.Teams
+
+	maintainers := toLogins(roles.maintainers)
+	if !t.Enable {
+		grant(maintainers, p.Maintainer)
+	}
+
+	committers := toLogins(roles.committers)
+	grant(committers, p.Committer)
+
+	if p.Contributor != "" {
+		grant(toLogins(roles.contributors), p.Contributor)
+	}
+
+	admins := toLogins(roles.admins)
+	if !t.Enable || !t.AdminTeam {
+		grant(admins, p.Admin)
+	}
+
+	grant(toLogins(repo.Viewers), permissionPull)
+	grant(toLogins(repo.Reporters), permissionTriage)
+	grant(toLogins(repo.Developers), permissionPush)
+	grant(toLogins(repo.Managers), permissionMaintain)
+
+	return append(maintainers, committers...), admins, r
+}
+
+func (bot *robot) handleMember(
+	expectRepo expectRepoInfo,
+	localMembers []string,
+	localPermissions map[string]string,
+	repoOwner *string,
+	log *logrus.Entry,
+) ([]string, map[string]string) {
 	org := expectRepo.org
 	repo := expectRepo.getNewRepoName()
 
-	if len(localMembers) == 0 {
+	if len(localMembers) == 0 || localPermissions == nil {
 		ms, err := bot.cli.ListCollaborator(gc.PRInfo{Org: org, Repo: repo})
-		members := make([]string, 0)
-		if err != nil || len(ms) == 0 {
+		if err != nil {
 			log.Errorf("handle repo members and get repo:%s, err:%s", repo, err.Error())
 			return nil, nil
 		}
-
-		for _, n := range ms {
-			members = append(members, *n.Login)
+		if len(ms) == 0 {
+			log.Errorf("handle repo members and get repo:%s, err:no collaborators", repo)
+			return nil, nil
 		}
-		localMembers = toLowerOfMembers(members)
+
+		localMembers, localPermissions = toCollaboratorState(ms)
 		*repoOwner = owner
 	}
 
-	expect := sets.NewString(expectRepo.expectOwners...)
-	lm := sets.NewString(localMembers...)
-	r := expect.Intersection(lm).UnsortedList()
+	expect := expectRepo.expectedPermissions()
 
-	expectAdmins := toLowerOfMembers(expectRepo.expectAdmins)
-	if len(expectAdmins) > 0 {
-		if len(localAdmins) == 0 {
-			allCollaborators, err := bot.cli.ListCollaborator(gc.PRInfo{Org: org, Repo: repo})
-			if err != nil {
-				log.Errorf("list %s's all collaborators failed, err: %v", repo, err)
-			}
-
-			for _, item := range allCollaborators {
-				for per := range item.Permissions {
-					if per == "admin" && item.Permissions[per] == true {
-						localAdmins = append(localAdmins, strings.ToLower(*item.Login))
-					}
-				}
-			}
+	members := make([]string, 0, len(localMembers))
+	permissions := make(map[string]string, len(localPermissions))
+	keep := func(k, permission string) {
+		members = append(members, k)
+		if permission != "" {
+			permissions[k] = permission
 		}
 	}
-	ea := sets.NewString(expectAdmins...)
-	la := sets.NewString(localAdmins...)
-	a := ea.Intersection(la).UnsortedList()
 
-	// add new
-	if v := expect.Difference(lm); v.Len() > 0 {
-		for k := range v {
-			l := log.WithField("add member", fmt.Sprintf("%s:%s", repo, k))
-			l.Info("start")
+	for _, k := range localMembers {
+		lp := localPermissions[k]
 
-			// how about adding a member but he/she exits? see the comment of 'addRepoMember'
-			if err := bot.addRepoMember(org, repo, k); err != nil {
-				l.Error(err)
-			} else {
-				r = append(r, k)
-			}
-		}
-	}
+		ep, ok := expect[k]
 
-	// remove
-	if v := lm.Difference(expect); v.Len() > 0 {
-		o := *repoOwner
+		// the permission is granted by the team.
+		if expectRepo.isGrantedByTeam(k, ep) {
+			keep(k, lp)
+			continue
+		}
 
-		for k := range v {
-			if k == o {
-				// Gitee does not allow to remove the repo owner.
+		if !ok {
+			// remove
+			if isReservedMember(k, *repoOwner) {
+				keep(k, lp)
 				continue
 			}
 
@@ -84,89 +165,99 @@ func (bot *robot) handleMember(expectRepo expectRepoInfo, localMembers, localAdm
 			if err := bot.cli.RemoveRepoMember(gc.PRInfo{Org: org, Repo: repo}, k); err != nil {
 				l.Error(err)
 
-				r = append(r, k)
+				keep(k, lp)
+			} else {
+				recordChange(changeMemberRemoved)
 			}
+
+			continue
 		}
-	}
 
-	// add maintain
-	if v := ea.Difference(la); v.Len() > 0 {
-		for k := range v {
-			if !expect.Has(k) {
-				continue
-			}
+		if lp == ep || isReservedMember(k, *repoOwner) {
+			keep(k, lp)
+			continue
+		}
 
-			if expect.Has(k) {
+		// fix the permission drift
+		l := log.WithField("update permission", fmt.Sprintf("%s:%s from %s to %s", repo, k, lp, ep))
+		l.Info("start")
 
-				l := log.WithField("update developer to admin", fmt.Sprintf("%s:%s", repo, k))
-				l.Info("start")
+		if err := bot.addCollaborator(org, repo, k, ep); err != nil {
+			l.Error(err)
 
-				if err := bot.cli.RemoveRepoMember(gc.PRInfo{Org: org, Repo: repo}, k); err != nil {
-					l.Errorf("remove developer %s from %s/%s failed, err: %v", k, org, repo, err)
-				}
+			keep(k, lp)
+		} else {
+			recordChange(changeMemberUpdated)
 
-				if err := bot.addRepoAdmin(org, repo, k); err != nil {
-					l.Errorf("add admin %s to %s/%s failed, err: %v", k, org, repo, err)
-				} else {
-					a = append(a, k)
-				}
-			}
+			keep(k, ep)
 		}
 	}
 
-	// remove maintain
-	if v := la.Difference(ea); v.Len() > 0 {
-		o := *repoOwner
+	// add new
+	lm := make(map[string]bool, len(localMembers))
+	for _, k := range localMembers {
+		lm[k] = true
+	}
 
-		if o == "" {
-			v, err := bot.cli.GetRepo(org, repo)
-			if err != nil {
-				log.Errorf("handle repo members and get repo:%s, err:%s", repo, err.Error())
-				return nil, nil
-			}
-			*repoOwner = *v.Owner.Login
-			o = *repoOwner
+	for k, ep := range expect {
+		if lm[k] || expectRepo.isGrantedByTeam(k, ep) {
+			continue
 		}
 
-		for k := range v {
-
-			if k == o || k == "openeuler-ci-bot" {
-				continue
-			}
+		l := log.WithField("add member", fmt.Sprintf("%s:%s", repo, k))
+		l.Info("start")
 
-			if expect.Has(k) {
+		// how about adding a member but he/she exits? see the comment of 'addCollaborator'
+		if err := bot.addCollaborator(org, repo, k, ep); err != nil {
+			l.Error(err)
+		} else {
+			recordChange(changeMemberAdded)
 
-				l := log.WithField("update admin to developer", fmt.Sprintf("%s:%s", repo, k))
-				l.Info("start")
-
-				if err := bot.cli.RemoveRepoMember(gc.PRInfo{Org: org, Repo: repo}, k); err != nil {
-					l.Errorf("remove admin %s from %s/%s failed, err: %v", k, org, repo, err)
-					a = append(a, k)
-				}
-
-				if err := bot.addRepoMember(org, repo, k); err != nil {
-					l.Errorf("add developer %s to %s/%s failed, err: %v", k, org, repo, err)
-				}
-			}
+			keep(k, ep)
 		}
 	}
 
-	return r, a
+	return members, permissions
+}
+
+// isReservedMember returns true if the member should not be removed or changed.
+func isReservedMember(login, repoOwner string) bool {
+	return strings.EqualFold(login, repoOwner) || strings.EqualFold(login, owner) || login == ciBot
 }
 
-// Gitee api will be successful even if adding a member repeatedly.
-func (bot *robot) addRepoMember(org, repo, login string) error {
-	return bot.cli.AddRepoMember(gc.PRInfo{Org: org, Repo: repo}, login, "push")
+// GitHub api will be successful even if adding a member repeatedly,
+// and it will update the permission if the member exists.
+func (bot *robot) addCollaborator(org, repo, login, permission string) error {
+	return bot.cli.AddRepoMember(gc.PRInfo{Org: org, Repo: repo}, login, permission)
 }
 
-func (bot *robot) addRepoAdmin(org, repo, login string) error {
-	return bot.cli.AddRepoMember(gc.PRInfo{Org: org, Repo: repo}, login, "maintain")
+// toCollaboratorState returns the lower case logins of collaborators and their permissions.
+func toCollaboratorState(users []*sdk.User) ([]string, map[string]string) {
+	members := make([]string, 0, len(users))
+	permissions := make(map[string]string, len(users))
+
+	for _, u := range users {
+		k := strings.ToLower(u.GetLogin())
+		members = append(members, k)
+
+		if p := permissionOfUser(u); p != "" {
+			permissions[k] = p
+		}
+	}
+
+	return members, permissions
 }
 
-func toLowerOfMembers(m []string) []string {
-	v := make([]string, len(m))
-	for i := range m {
-		v[i] = strings.ToLower(m[i])
+// permissionOfUser returns the highest permission of the collaborator.
+func permissionOfUser(u *sdk.User) string {
+	r := ""
+	for k, v := range u.Permissions {
+		if v {
+			if _, ok := permissionLevels[k]; ok {
+				r = higherPermission(r, k)
+			}
+		}
 	}
-	return v
+
+	return r
 }
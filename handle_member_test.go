@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+
+	gc "github.com/opensourceways/community-robot-lib/githubclient"
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
+)
+
+type memberClient struct {
+	iClient
+
+	added   map[string]string
+	removed []string
+}
+
+func (c *memberClient) AddRepoMember(pr gc.PRInfo, login, permission string) error {
+	c.added[login] = permission
+	return nil
+}
+
+func (c *memberClient) RemoveRepoMember(pr gc.PRInfo, login string) error {
+	c.removed = append(c.removed, login)
+	return nil
+}
+
+func TestHandleMember(t *testing.T) {
+	cli := &memberClient{added: map[string]string{}}
+	bot := robot{cli: cli}
+
+	e := expectRepoInfo{
+		org:             "src-openeuler",
+		expectRepoState: &community.Repository{Name: "test"},
+		expectMembers: map[string]string{
+			"tom":   permissionPush,
+			"jerry": permissionMaintain,
+			"spike": permissionTriage,
+		},
+	}
+
+	localPermissions := map[string]string{
+		"tom":           permissionPush,
+		"jerry":         permissionPush,
+		"tuffy":         permissionPush,
+		"openeuler-bot": permissionAdmin,
+	}
+	localMembers := []string{"tom", "jerry", "tuffy", "openeuler-bot"}
+	repoOwner := "openEuler-bot"
+
+	members, permissions := bot.handleMember(
+		e, localMembers, localPermissions, &repoOwner, logrus.NewEntry(logrus.New()),
+	)
+
+	if len(cli.added) != 2 || cli.added["jerry"] != permissionMaintain || cli.added["spike"] != permissionTriage {
+		t.Errorf("unexpected added members: %v", cli.added)
+	}
+
+	if len(cli.removed) != 1 || cli.removed[0] != "tuffy" {
+		t.Errorf("unexpected removed members: %v", cli.removed)
+	}
+
+	if len(members) != 4 || permissions["jerry"] != permissionMaintain || permissions["spike"] != permissionTriage {
+		t.Errorf("unexpected state: %v, %v", members, permissions)
+	}
+}
+
+func TestHandleMemberOfTeam(t *testing.T) {
+	cli := &memberClient{added: map[string]string{}}
+	bot := robot{cli: cli}
+
+	e := expectRepoInfo{
+		org:             "src-openeuler",
+		expectRepoState: &community.Repository{Name: "test"},
+		expectMembers: map[string]string{
+			"tom":   permissionPush,
+			"jerry": permissionAdmin,
+		},
+		teamMembers: map[string]string{
+			"tom":   permissionMaintain,
+			"jerry": permissionMaintain,
+			"spike": permissionMaintain,
+		},
+	}
+
+	localPermissions := map[string]string{
+		"tom":   permissionMaintain,
+		"jerry": permissionMaintain,
+		"spike": permissionMaintain,
+	}
+	localMembers := []string{"tom", "jerry", "spike"}
+	repoOwner := "openEuler-bot"
+
+	_, permissions := bot.handleMember(
+		e, localMembers, localPermissions, &repoOwner, logrus.NewEntry(logrus.New()),
+	)
+
+	// only the permission which is higher than the one of team is granted.
+	if len(cli.added) != 1 || cli.added["jerry"] != permissionAdmin {
+		t.Errorf("unexpected added members: %v", cli.added)
+	}
+
+	if len(cli.removed) != 0 {
+		t.Errorf("unexpected removed members: %v", cli.removed)
+	}
+
+	if permissions["jerry"] != permissionAdmin || permissions["spike"] != permissionMaintain {
+		t.Errorf("unexpected state: %v", permissions)
+	}
+}
@@ -1,10 +1,8 @@
 package main
 
 import (
-	"encoding/base64"
 	"fmt"
 	"path"
-	"strings"
 	"sync"
 	"time"
 
@@ -25,9 +23,9 @@ type PackageInfo struct {
 
 var m sync.Mutex
 
-func (bot *robot) patchFactoryYaml(repo string, log *logrus.Entry) {
+func (bot *robot) patchFactoryYaml(project *obsMetaProject, repo string, log *logrus.Entry) {
 
-	if !bot.cfg.EnableCreatingOBSMetaProject {
+	if project == nil {
 		return
 	}
 
@@ -35,18 +33,13 @@ func (bot *robot) patchFactoryYaml(repo string, log *logrus.Entry) {
 	defer m.Unlock()
 	var y yamlStruct
 
-	project := &bot.cfg.OBSMetaProject
 	readingPath := path.Join(project.ProjectDir, project.ProjectFileName)
 	b := &project.Branch
+	src := bot.newSource(b)
 
-	f, err := bot.cli.GetPathContent(b.Org, b.Repo, readingPath, b.Branch)
-	if err != nil {
-		log.Errorf("get file %s failed.", readingPath)
-		return
-	}
-
-	c, err := base64.StdEncoding.DecodeString(*f.Content)
+	c, sha, err := src.loadFile(readingPath)
 	if err != nil {
+		log.Errorf("get file %s failed, err:%s", readingPath, err.Error())
 		return
 	}
 
@@ -66,103 +59,19 @@ func (bot *robot) patchFactoryYaml(repo string, log *logrus.Entry) {
 		return
 	}
 
-	message := fmt.Sprintf("a new series of repositories has been created")
-	err = bot.cli.CreateFile(b.Org, b.Repo, readingPath, b.Branch, message, *f.SHA, by)
-	if err != nil {
-		log.Errorf("update file failed %v", err)
+	// the source may be not GitHub, so the change is recorded here in dry-run mode.
+	if bot.plan != nil {
+		bot.plan.add(planAction{
+			Action: actionCreateFile, Org: b.Org, Repo: b.Repo, Target: readingPath,
+			Detail: fmt.Sprintf("branch:%s", b.Branch),
+		})
 		return
 	}
-}
-
-func (bot *robot) getRefresh(log *logrus.Entry) []PackageInfo {
-	project := &bot.cfg.OBSMetaProject
-	b := &project.Branch
-
-	// get dir name
-	tree, err := bot.cli.GetDirectoryTree(b.Org, b.Repo, "master", true)
-	if err != nil {
-		log.Errorf("list dirs in release-management/master failed, %v", err)
-		return nil
-	}
-
-	var allPackages []PackageInfo
-
-	for _, t := range tree {
-		for p, s := range PckgShaMap {
-			if *t.Path == p && s != t.GetSHA() {
-				PckgShaMap[p] = t.GetSHA()
 
-				var y yamlStruct
-				f, err := bot.cli.GetPathContent(b.Org, b.Repo, *t.Path, b.Branch)
-				if err != nil {
-					log.Errorf("get file %s failed. error is: %v", *t.Path, err)
-					continue
-				}
-
-				c, err := base64.StdEncoding.DecodeString(*f.Content)
-				if err != nil {
-					continue
-				}
-
-				if err = yaml.Unmarshal(c, &y); err != nil {
-					continue
-				}
-
-				AllPackagesInPckg[p] = y.Packages
-			}
-		}
-
-	}
-
-	for _, p := range AllPackagesInPckg {
-		allPackages = append(allPackages, p...)
-	}
-
-	return allPackages
-}
-
-var AllPackagesInPckg map[string][]PackageInfo
-var PckgShaMap map[string]string
-
-func (bot *robot) loadAllPckgMgmtFile() error {
-	AllPackagesInPckg = map[string][]PackageInfo{}
-	PckgShaMap = map[string]string{}
-	project := &bot.cfg.OBSMetaProject
-	b := &project.Branch
-
-	// get tree
-	tree, err := bot.gecli.GetDirectoryTree(b.Org, b.Repo, "master", 1)
+	message := fmt.Sprintf("a new series of repositories has been created")
+	err = src.updateFile(readingPath, sha, message, by)
 	if err != nil {
-		return err
-	}
-
-	for _, t := range tree.Tree {
-		if strings.Contains(t.Path, "openEuler") && strings.HasPrefix(t.Path, "master/") && strings.HasSuffix(t.Path, project.ProjectFileName) {
-			PckgShaMap[t.Path] = t.Sha
-
-			var y yamlStruct
-			f, err := bot.gecli.GetPathContent(b.Org, b.Repo, t.Path, b.Branch)
-			if err != nil {
-				continue
-			}
-
-			c, err := base64.StdEncoding.DecodeString(f.Content)
-			if err != nil {
-				continue
-			}
-
-			if err = yaml.Unmarshal(c, &y); err != nil {
-				continue
-			}
-
-			var allPackages []PackageInfo
-			for _, r := range y.Packages {
-				allPackages = append(allPackages, r)
-			}
-
-			AllPackagesInPckg[t.Path] = allPackages
-		}
+		log.Errorf("update file failed %v", err)
+		return
 	}
-
-	return nil
 }
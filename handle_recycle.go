@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+
+	sdk "github.com/google/go-github/v36/github"
+	gc "github.com/opensourceways/community-robot-lib/githubclient"
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/models"
+)
+
+// recycleRepo archives the repo of sig-recycle after removing the collaborators who can push
+// and the teams granted to it, and then transfers it to the attic org if it is set.
+func (bot *robot) recycleRepo(expectRepo expectRepoInfo, before models.RepoState, log *logrus.Entry) models.RepoState {
+	if !before.Available {
+		return before
+	}
+
+	org := expectRepo.org
+	repo := expectRepo.getNewRepoName()
+	attic := bot.cfg.Recycle.AtticOrg
+	p := &before.Property
+
+	if p.Archived && (attic == "" || p.AtticOrg != "") {
+		p.Recycled = true
+
+		return before
+	}
+
+	log = log.WithField("recycle repo", repo)
+	log.Info("start")
+
+	if !p.Archived {
+		ms, ps, ok := bot.removeCollaborators(
+			org, repo, before.Members, before.Permissions, &before.Owner, permissionPush, log,
+		)
+		before.Members, before.Permissions = ms, ps
+		if !ok {
+			return before
+		}
+
+		if before.Teams, ok = bot.removeTeams(org, repo, before.Teams, log); !ok {
+			return before
+		}
+
+		if err := bot.setArchived(org, repo, true); err != nil {
+			log.Errorf("archive repo, err:%s", err.Error())
+
+			return before
+		}
+
+		p.Archived = true
+		recordChange(changeRepoArchived)
+	}
+
+	p.Recycled = true
+
+	if attic != "" {
+		if err := bot.cli.TransferRepo(org, repo, attic); err != nil {
+			log.Errorf("transfer repo to %s, err:%s", attic, err.Error())
+
+			return before
+		}
+
+		p.AtticOrg = attic
+		recordChange(changeRepoTransferred)
+	}
+
+	return before
+}
+
+// reviveRepo transfers the recycled repo back from the attic org and unarchives it.
+// It returns false if failed.
+func (bot *robot) reviveRepo(org, repo string, p *models.RepoProperty, log *logrus.Entry) bool {
+	log = log.WithField("revive repo", repo)
+	log.Info("start")
+
+	if p.AtticOrg != "" {
+		if err := bot.cli.TransferRepo(p.AtticOrg, repo, org); err != nil {
+			log.Errorf("transfer repo back from %s, err:%s", p.AtticOrg, err.Error())
+
+			return false
+		}
+
+		p.AtticOrg = ""
+	}
+
+	if p.Archived {
+		if err := bot.setArchived(org, repo, false); err != nil {
+			log.Errorf("unarchive repo, err:%s", err.Error())
+
+			return false
+		}
+
+		p.Archived = false
+	}
+
+	p.Recycled = false
+	recordChange(changeRepoRevived)
+
+	return true
+}
+
+// findRepoInAttic returns the state of the repo if it has been transferred to the attic org.
+func (bot *robot) findRepoInAttic(repo string, log *logrus.Entry) models.RepoState {
+	attic := bot.cfg.Recycle.AtticOrg
+	if attic == "" {
+		return models.RepoState{}
+	}
+
+	v, err := bot.cli.GetRepo(attic, repo)
+	if err != nil {
+		return models.RepoState{}
+	}
+
+	log.Infof("found repo:%s in the attic org:%s", repo, attic)
+
+	p := toRepoProperty(v)
+	p.AtticOrg = attic
+
+	return models.RepoState{
+		Available: true,
+		Property:  p,
+	}
+}
+
+func (bot *robot) setArchived(org, repo string, archived bool) error {
+	return bot.cli.UpdateRepo(org, repo, &sdk.Repository{
+		Name:     &repo,
+		Archived: &archived,
+	})
+}
+
+// removeCollaborators removes the collaborators whose permissions are not lower than lowest
+// except the reserved ones. It returns the remaining collaborators and false if failed to
+// remove any of them.
+func (bot *robot) removeCollaborators(
+	org, repo string,
+	members []string,
+	permissions map[string]string,
+	repoOwner *string,
+	lowest string,
+	log *logrus.Entry,
+) ([]string, map[string]string, bool) {
+	if len(members) == 0 || permissions == nil {
+		v, err := bot.cli.ListCollaborator(gc.PRInfo{Org: org, Repo: repo})
+		if err != nil {
+			log.Errorf("list collaborators, err:%s", err.Error())
+
+			return members, permissions, false
+		}
+
+		members, permissions = toCollaboratorState(v)
+	}
+
+	ok := true
+	remaining := make([]string, 0, len(members))
+	for _, k := range members {
+		p := permissions[k]
+		if permissionLevels[p] < permissionLevels[lowest] || isReservedMember(k, *repoOwner) {
+			remaining = append(remaining, k)
+			continue
+		}
+
+		l := log.WithField("remove member", fmt.Sprintf("%s:%s", repo, k))
+		l.Info("start")
+
+		if err := bot.cli.RemoveRepoMember(gc.PRInfo{Org: org, Repo: repo}, k); err != nil {
+			l.Error(err)
+
+			ok = false
+			remaining = append(remaining, k)
+		} else {
+			recordChange(changeMemberRemoved)
+			delete(permissions, k)
+		}
+	}
+
+	return remaining, permissions, ok
+}
+
+// removeTeams revokes the teams granted to the repo. It returns the remaining teams
+// and false if failed to revoke any of them.
+func (bot *robot) removeTeams(org, repo string, teams map[string]string, log *logrus.Entry) (map[string]string, bool) {
+	var remaining map[string]string
+
+	for slug, p := range teams {
+		l := log.WithField("remove team repo", fmt.Sprintf("%s:%s", repo, slug))
+		l.Info("start")
+
+		if err := bot.cli.RemoveTeamRepo(org, slug, repo); err != nil {
+			l.Error(err)
+
+			if remaining == nil {
+				remaining = make(map[string]string)
+			}
+			remaining[slug] = p
+		} else {
+			recordChange(changeTeamRepoRemoved)
+		}
+	}
+
+	return remaining, remaining == nil
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"fmt"
+	"strings"
+	"time"
+
 	gc "github.com/opensourceways/community-robot-lib/githubclient"
 
 	sdk "github.com/google/go-github/v36/github"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
 	"github.com/opensourceways/robot-github-openeuler-repo-watcher/models"
@@ -32,10 +36,12 @@ func (bot *robot) createRepo(
 		log.Warning("repo exists already")
 
 		if s, b := bot.getRepoState(org, repoName, log); b {
-			s.Branches = bot.handleBranch(expectRepo, s.Branches, log)
-			ms, as := bot.handleMember(expectRepo, s.Members, s.Admins, &s.Owner, log)
+			s.Branches, s.UndeclaredBranches, _ = bot.handleBranch(
+				expectRepo, s.Branches, nil, s.Property.Settings.DefaultBranch, false, log,
+			)
+			ms, ps := bot.handleMember(expectRepo, s.Members, s.Permissions, &s.Owner, log)
 			s.Members = ms
-			s.Admins = as
+			s.Permissions = ps
 			return s
 		}
 
@@ -44,36 +50,54 @@ func (bot *robot) createRepo(
 		return models.RepoState{}
 	}
 
-	OneCheckTotalRepos += 1
+	recordChange(changeRepoCreated)
 
 	defer func() {
 		hook(repoName, log)
 	}()
 
-	branches, members := bot.initNewlyCreatedRepo(
-		org, repoName, repo.Branches, expectRepo.expectOwners, log,
+	expectBranches := make([]community.RepoBranch, len(repo.Branches))
+	for i := range repo.Branches {
+		expectBranches[i] = bot.expectBranch(expectRepo, &repo.Branches[i])
+	}
+
+	property.Settings.DefaultBranch = bot.initDefaultBranch(
+		org, repoName, bot.cfg.repoSettings(org, repo).DefaultBranch, log,
+	)
+
+	bot.applyTemplate(expectRepo, property.Settings.DefaultBranch, log)
+
+	branches, members, permissions := bot.initNewlyCreatedRepo(
+		org, repoName, property.Settings.DefaultBranch, expectBranches, expectRepo.expectedPermissions(), log,
 	)
 
 	return models.RepoState{
-		Available: true,
-		Branches:  branches,
-		Members:   members,
-		Property:  property,
+		Available:   true,
+		Branches:    branches,
+		Members:     members,
+		Permissions: permissions,
+		Property:    property,
 	}
 }
 
 func (bot *robot) newRepo(org string, repo *community.Repository) (models.RepoProperty, error) {
 	has := true
 	private := repo.IsPrivate()
-	err := bot.cli.CreateRepo(org, &sdk.Repository{
+
+	// the default branch can't be set until it exists.
+	settings := bot.cfg.repoSettings(org, repo)
+	settings.DefaultBranch = ""
+
+	r := &sdk.Repository{
 		Name:        &repo.Name,
 		Description: &repo.Description,
-		HasIssues:   &has,
-		HasWiki:     &has,
-		AutoInit:    &has, // set `auto_init` as true to initialize `master` branch with README after repo creation
+		Homepage:    &repo.Homepage,
+		AutoInit:    &has, // set `auto_init` as true to initialize the default branch with README after repo creation
 		Private:     &private,
-	})
-	if err != nil {
+	}
+	applySettings(r, &settings)
+
+	if err := bot.cli.CreateRepo(org, r); err != nil {
 		return models.RepoProperty{}, err
 	}
 
@@ -83,32 +107,35 @@ func (bot *robot) newRepo(org string, repo *community.Repository) (models.RepoPr
 	//}
 
 	return models.RepoProperty{
-		CanComment: repo.Commentable,
-		Private:    repo.IsPrivate(),
+		CanComment:  repo.Commentable,
+		Private:     repo.IsPrivate(),
+		Description: repo.Description,
+		Homepage:    repo.Homepage,
+		Settings:    settings,
 	}, nil
 }
 
 func (bot *robot) initNewlyCreatedRepo(
-	org, repoName string,
+	org, repoName, defaultBranch string,
 	repoBranches []community.RepoBranch,
-	repoOwners []string,
+	repoMembers map[string]string,
 	log *logrus.Entry,
-) ([]community.RepoBranch, []string) {
+) ([]community.RepoBranch, []string, map[string]string) {
 	//if err := bot.initRepoReviewer(org, repoName); err != nil {
 	//	log.Errorf("initialize the reviewers, err:%s", err.Error())
 	//}
 
 	branches := []community.RepoBranch{
-		{Name: community.BranchMaster},
+		{Name: defaultBranch},
 	}
 	for _, item := range repoBranches {
-		if item.Name == community.BranchMaster {
-			if item.Type != community.BranchProtected {
+		if item.Name == defaultBranch {
+			if !item.IsProtected() {
 				continue
 			}
 
-			if err := bot.updateBranch(org, repoName, item.Name, true); err == nil {
-				branches[0].Type = community.BranchProtected
+			if err := bot.updateBranch(org, repoName, &item); err == nil {
+				branches[0] = item
 			} else {
 				log.WithFields(logrus.Fields{
 					"update branch": fmt.Sprintf("%s/%s", repoName, item.Name),
@@ -116,22 +143,25 @@ func (bot *robot) initNewlyCreatedRepo(
 				}).Error(err)
 			}
 		} else {
-			if b, ok := bot.createBranch(org, repoName, item, log); ok {
+			if b, ok := bot.createBranch(org, repoName, item, defaultBranch, log); ok {
 				branches = append(branches, b)
 			}
 		}
 	}
 
 	members := []string{}
-	for _, item := range repoOwners {
-		if err := bot.addRepoMember(org, repoName, item); err != nil {
+	permissions := map[string]string{}
+	for item, permission := range repoMembers {
+		if err := bot.addCollaborator(org, repoName, item, permission); err != nil {
 			log.Errorf("add member:%s, err:%s", item, err)
 		} else {
+			recordChange(changeMemberAdded)
 			members = append(members, item)
+			permissions[item] = permission
 		}
 	}
 
-	return branches, members
+	return branches, members, permissions
 }
 
 func (bot *robot) renameRepo(
@@ -160,8 +190,8 @@ func (bot *robot) renameRepo(
 	//	log.Infof("update label failed: %v", err)
 	//}
 
-	if err != nil {
-		OneCheckTotalRepos += 1
+	if err == nil {
+		recordChange(changeRepoRenamed)
 	}
 
 	defer func(b bool) {
@@ -174,10 +204,12 @@ func (bot *robot) renameRepo(
 	// if the err != nil, it is better to call 'getRepoState' to
 	// avoid the case that the repo already exists.
 	if s, b := bot.getRepoState(org, newRepo, log); b {
-		s.Branches = bot.handleBranch(expectRepo, s.Branches, log)
-		ms, as := bot.handleMember(expectRepo, s.Members, s.Admins, &s.Owner, log)
+		s.Branches, s.UndeclaredBranches, _ = bot.handleBranch(
+			expectRepo, s.Branches, nil, s.Property.Settings.DefaultBranch, false, log,
+		)
+		ms, ps := bot.handleMember(expectRepo, s.Members, s.Permissions, &s.Owner, log)
 		s.Members = ms
-		s.Admins = as
+		s.Permissions = ps
 		return s
 	}
 
@@ -190,6 +222,41 @@ func (bot *robot) renameRepo(
 	return models.RepoState{Available: true}
 }
 
+func toRepoProperty(r *sdk.Repository) models.RepoProperty {
+	return models.RepoProperty{
+		Private:     r.GetPrivate(),
+		Archived:    r.GetArchived(),
+		Description: r.GetDescription(),
+		Homepage:    r.GetHomepage(),
+		Topics:      r.Topics,
+		Settings: community.RepoSettings{
+			HasIssues:           r.HasIssues,
+			HasWiki:             r.HasWiki,
+			HasProjects:         r.HasProjects,
+			AllowSquashMerge:    r.AllowSquashMerge,
+			AllowMergeCommit:    r.AllowMergeCommit,
+			AllowRebaseMerge:    r.AllowRebaseMerge,
+			DeleteBranchOnMerge: r.DeleteBranchOnMerge,
+			DefaultBranch:       r.GetDefaultBranch(),
+		},
+	}
+}
+
+// applySettings sets the items of r which are set in s.
+func applySettings(r *sdk.Repository, s *community.RepoSettings) {
+	r.HasIssues = s.HasIssues
+	r.HasWiki = s.HasWiki
+	r.HasProjects = s.HasProjects
+	r.AllowSquashMerge = s.AllowSquashMerge
+	r.AllowMergeCommit = s.AllowMergeCommit
+	r.AllowRebaseMerge = s.AllowRebaseMerge
+	r.DeleteBranchOnMerge = s.DeleteBranchOnMerge
+
+	if s.DefaultBranch != "" {
+		r.DefaultBranch = &s.DefaultBranch
+	}
+}
+
 func (bot *robot) getRepoState(org, repo string, log *logrus.Entry) (models.RepoState, bool) {
 	newRepo, err := bot.cli.GetRepo(org, repo)
 	if err != nil {
@@ -204,10 +271,8 @@ func (bot *robot) getRepoState(org, repo string, log *logrus.Entry) (models.Repo
 		r := models.RepoState{
 			Available: true,
 			Members:   members,
-			Property: models.RepoProperty{
-				Private: *newRepo.Private,
-			},
-			Owner: *newRepo.Owner.Login,
+			Property:  toRepoProperty(newRepo),
+			Owner:     *newRepo.Owner.Login,
 		}
 
 		branches, err := bot.listAllBranchOfRepo(org, repo)
@@ -220,17 +285,14 @@ func (bot *robot) getRepoState(org, repo string, log *logrus.Entry) (models.Repo
 		return r, true
 	}
 
-	for _, m := range ms {
-		members = append(members, *m.Login)
-	}
+	members, permissions := toCollaboratorState(ms)
 
 	r := models.RepoState{
-		Available: true,
-		Members:   toLowerOfMembers(members),
-		Property: models.RepoProperty{
-			Private: *newRepo.Private,
-		},
-		Owner: *newRepo.Owner.Login,
+		Available:   true,
+		Members:     members,
+		Permissions: permissions,
+		Property:    toRepoProperty(newRepo),
+		Owner:       *newRepo.Owner.Login,
 	}
 
 	branches, err := bot.listAllBranchOfRepo(org, repo)
@@ -261,29 +323,171 @@ func (bot *robot) updateRepo(expectRepo expectRepoInfo, lp models.RepoProperty,
 	repo := expectRepo.expectRepoState
 	repoName := expectRepo.getNewRepoName()
 
+	log = log.WithField("update repo", repoName)
+
 	ep := repo.IsPrivate()
+	es := bot.cfg.repoSettings(org, repo)
+	// the default branch is handled by 'handleDefaultBranch'
+	es.DefaultBranch = ""
+	settings, settingsChanged := lp.Settings.Diff(&es)
 
-	if ep != lp.Private {
-		log = log.WithField("update repo", repoName)
+	if ep != lp.Private || repo.Description != lp.Description || repo.Homepage != lp.Homepage || settingsChanged {
 		log.Info("start")
 
-		err := bot.cli.UpdateRepo(
-			org,
-			repoName,
-			&sdk.Repository{
-				Name:    &repoName,
-				Private: &ep,
-			},
-		)
-		if err == nil {
-			return models.RepoProperty{
-				Private: ep,
-			}
+		r := &sdk.Repository{
+			Name:        &repoName,
+			Private:     &ep,
+			Description: &repo.Description,
+			Homepage:    &repo.Homepage,
 		}
+		applySettings(r, &settings)
+
+		if err := bot.cli.UpdateRepo(org, repoName, r); err == nil {
+			lp.Private = ep
+			lp.Description = repo.Description
+			lp.Homepage = repo.Homepage
+			lp.Settings.Update(&settings)
+
+			recordChange(changeRepoUpdated)
+		} else {
+			log.WithFields(logrus.Fields{
+				"Private":     ep,
+				"Description": repo.Description,
+				"Homepage":    repo.Homepage,
+				"Settings":    fmt.Sprintf("%+v", settings),
+			}).Error(err)
+		}
+	}
 
-		log.WithFields(logrus.Fields{
-			"Private": ep,
-		}).Error(err)
+	bot.updateCommentable(expectRepo, &lp, log)
+
+	managed := expectTopics(repo, expectRepo.sig)
+	if topics := mergeTopics(lp.Topics, lp.ManagedTopics, managed); !sets.NewString(lp.Topics...).Equal(sets.NewString(topics...)) {
+		if err := bot.cli.ReplaceTopics(org, repoName, topics); err == nil {
+			lp.Topics = topics
+			lp.ManagedTopics = managed
+
+			recordChange(changeRepoUpdated)
+		} else {
+			log.WithField("Topics", topics).Error(err)
+		}
+	} else {
+		lp.ManagedTopics = managed
 	}
+
 	return lp
 }
+
+const (
+	// the longest expiry supported by GitHub
+	commentLimitExpiry = "six_months"
+
+	// the limit will be renewed if it will expire within this duration
+	commentLimitRenewal = 7 * 24 * time.Hour
+)
+
+// updateCommentable maps the repo which is not commentable to the interaction limit of GitHub.
+// The limit expires, so it is renewed before expiring.
+func (bot *robot) updateCommentable(expectRepo expectRepoInfo, lp *models.RepoProperty, log *logrus.Entry) {
+	limit := bot.cfg.CommentLimit
+	if limit == "" {
+		return
+	}
+
+	org := expectRepo.org
+	repoName := expectRepo.getNewRepoName()
+
+	// the limit is unknown if the state is loaded from GitHub, so load it.
+	if !lp.CanComment && lp.CommentLimitExpiresAt.IsZero() {
+		v, err := bot.cli.GetInteractionLimit(org, repoName)
+		if err != nil {
+			log.Errorf("get interaction limit, err:%s", err.Error())
+			return
+		}
+
+		lp.CanComment = v.IsZero()
+		lp.CommentLimitExpiresAt = v
+	}
+
+	if expectRepo.expectRepoState.Commentable {
+		if lp.CanComment {
+			return
+		}
+
+		if err := bot.cli.RemoveInteractionLimit(org, repoName); err != nil {
+			log.WithField("CanComment", true).Error(err)
+			return
+		}
+
+		lp.CanComment = true
+		lp.CommentLimitExpiresAt = time.Time{}
+		recordChange(changeRepoUpdated)
+
+		return
+	}
+
+	if !lp.CanComment && time.Until(lp.CommentLimitExpiresAt) > commentLimitRenewal {
+		return
+	}
+
+	v, err := bot.cli.SetInteractionLimit(org, repoName, limit, commentLimitExpiry)
+	if err != nil {
+		log.WithField("CanComment", false).Error(err)
+		return
+	}
+
+	lp.CanComment = false
+	lp.CommentLimitExpiresAt = v
+	recordChange(changeRepoUpdated)
+}
+
+// the max length of topic supported by GitHub
+const maxTopicLength = 50
+
+// expectTopics returns the topics of repo including the sig name.
+func expectTopics(repo *community.Repository, sig string) []string {
+	s := sets.NewString()
+	for _, v := range repo.Topics {
+		if v = toTopic(v); v != "" {
+			s.Insert(v)
+		}
+	}
+
+	if v := toTopic(sig); v != "" {
+		s.Insert(v)
+	}
+
+	return s.List()
+}
+
+// toTopic converts s to a topic of GitHub, which consists of lower case letters,
+// numbers and hyphens, and starts with a letter or number.
+func toTopic(s string) string {
+	b := strings.Builder{}
+	hyphen := false
+
+	for _, c := range strings.ToLower(s) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+			hyphen = false
+		} else if b.Len() > 0 && !hyphen {
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+
+	v := b.String()
+	if len(v) > maxTopicLength {
+		v = v[:maxTopicLength]
+	}
+
+	return strings.TrimRight(v, "-")
+}
+
+// mergeTopics replaces the topics which were managed by the watcher with the
+// expected ones, and keeps the others of the repo.
+func mergeTopics(topics, managed, expect []string) []string {
+	s := sets.NewString(topics...).Delete(managed...).Insert(expect...)
+
+	return s.List()
+}
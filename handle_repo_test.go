@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
+)
+
+func TestExpectTopics(t *testing.T) {
+	repo := &community.Repository{
+		Topics: []string{" Go ", "C++", "--", "a_very_long_topic_which_is_longer_than_fifty_characters"},
+	}
+
+	topics := expectTopics(repo, "sig-Compiler")
+	expect := []string{"a-very-long-topic-which-is-longer-than-fifty-chara", "c", "go", "sig-compiler"}
+	if !reflect.DeepEqual(topics, expect) {
+		t.Errorf("unexpected topics: %v", topics)
+	}
+
+	merged := mergeTopics([]string{"go", "old-sig", "custom"}, []string{"go", "old-sig"}, []string{"go", "sig-compiler"})
+	if !reflect.DeepEqual(merged, []string{"custom", "go", "sig-compiler"}) {
+		t.Errorf("unexpected merged topics: %v", merged)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthState records the progress of watching which the probes are based on.
+type healthState struct {
+	lock      sync.RWMutex
+	ready     bool
+	lastCheck time.Time
+	timeout   time.Duration
+}
+
+func newHealthState(timeout time.Duration) *healthState {
+	return &healthState{timeout: timeout}
+}
+
+func (h *healthState) setReady() {
+	if h == nil {
+		return
+	}
+
+	h.lock.Lock()
+	h.ready = true
+	h.lastCheck = time.Now()
+	h.lock.Unlock()
+}
+
+func (h *healthState) setTimeout(timeout time.Duration) {
+	if h == nil {
+		return
+	}
+
+	h.lock.Lock()
+	h.timeout = timeout
+	h.lock.Unlock()
+}
+
+func (h *healthState) checkDone() {
+	if h == nil {
+		return
+	}
+
+	h.lock.Lock()
+	h.lastCheck = time.Now()
+	h.lock.Unlock()
+}
+
+func (h *healthState) isReady() bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return h.ready
+}
+
+// checkLive passes before ready, because loading the states of a large org at
+// startup may take longer than the timeout. The readiness probe covers that phase.
+func (h *healthState) checkLive() error {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	if !h.ready {
+		return nil
+	}
+
+	if v := time.Since(h.lastCheck); v > h.timeout {
+		return fmt.Errorf("no check has completed for %s", v.String())
+	}
+
+	return nil
+}
+
+func (h *healthState) healthz(w http.ResponseWriter, r *http.Request) {
+	if err := h.checkLive(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprint(w, "ok")
+}
+
+func (h *healthState) readyz(w http.ResponseWriter, r *http.Request) {
+	if !h.isReady() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprint(w, "ok")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+)
+
+// identityMapping is the mapping of gitee_id -> github_login which is maintained
+// in a yaml file. It is reloaded when the file changes.
+type identityMapping struct {
+	path string
+
+	lock    sync.RWMutex
+	modTime time.Time
+	m       map[string]string
+}
+
+func newIdentityMapping(path string) *identityMapping {
+	return &identityMapping{path: path}
+}
+
+func (im *identityMapping) refresh() error {
+	if im == nil {
+		return nil
+	}
+
+	info, err := os.Stat(im.path)
+	if err != nil {
+		return err
+	}
+
+	im.lock.RLock()
+	unchanged := info.ModTime().Equal(im.modTime)
+	im.lock.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(im.path)
+	if err != nil {
+		return err
+	}
+
+	v := make(map[string]string)
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	m := make(map[string]string, len(v))
+	for k, login := range v {
+		m[strings.ToLower(k)] = login
+	}
+
+	im.lock.Lock()
+	im.m = m
+	im.modTime = info.ModTime()
+	im.lock.Unlock()
+
+	return nil
+}
+
+func (im *identityMapping) get(giteeId string) (string, bool) {
+	if im == nil {
+		return "", false
+	}
+
+	im.lock.RLock()
+	defer im.lock.RUnlock()
+
+	v, ok := im.m[strings.ToLower(giteeId)]
+	return v, ok
+}
+
+// unmappedUsers records the users which can't be mapped to GitHub and the repos of them.
+type unmappedUsers struct {
+	lock  sync.Mutex
+	users map[string]sets.String
+}
+
+func newUnmappedUsers() *unmappedUsers {
+	return &unmappedUsers{users: make(map[string]sets.String)}
+}
+
+func (u *unmappedUsers) add(repo string, giteeIds ...string) {
+	if u == nil {
+		return
+	}
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	for _, id := range giteeIds {
+		if v, ok := u.users[id]; ok {
+			v.Insert(repo)
+		} else {
+			u.users[id] = sets.NewString(repo)
+		}
+	}
+}
+
+func (u *unmappedUsers) reset() {
+	if u == nil {
+		return
+	}
+
+	u.lock.Lock()
+	u.users = make(map[string]sets.String)
+	u.lock.Unlock()
+}
+
+type unmappedUser struct {
+	GiteeId string   `json:"gitee_id"`
+	Repos   []string `json:"repos"`
+}
+
+func (u *unmappedUsers) list() []unmappedUser {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	ids := make([]string, 0, len(u.users))
+	for k := range u.users {
+		ids = append(ids, k)
+	}
+
+	r := make([]unmappedUser, 0, len(ids))
+	for _, id := range sets.NewString(ids...).List() {
+		r = append(r, unmappedUser{GiteeId: id, Repos: u.users[id].List()})
+	}
+
+	return r
+}
+
+// report logs the unmapped users and writes them to the file if it is set.
+func (u *unmappedUsers) report(file string, log *logrus.Entry) {
+	if u == nil {
+		return
+	}
+
+	items := u.list()
+	if len(items) == 0 {
+		return
+	}
+
+	ids := make([]string, len(items))
+	for i := range items {
+		ids[i] = items[i].GiteeId
+	}
+	log.Warningf("%d users can't be mapped to GitHub: %s", len(ids), strings.Join(ids, ","))
+
+	if file == "" {
+		return
+	}
+
+	b, err := json.MarshalIndent(struct {
+		GeneratedAt time.Time      `json:"generated_at"`
+		Users       []unmappedUser `json:"users"`
+	}{
+		GeneratedAt: time.Now(),
+		Users:       items,
+	}, "", "  ")
+	if err != nil {
+		log.Errorf("marshal unmapped users, err:%s", err.Error())
+		return
+	}
+
+	if err := ioutil.WriteFile(file, b, 0644); err != nil {
+		log.Errorf("write unmapped users to %s, err:%s", file, err.Error())
+	}
+}
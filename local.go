@@ -1,9 +1,15 @@
 package main
 
 import (
+	"time"
+
+	sdk "github.com/google/go-github/v36/github"
 	gc "github.com/opensourceways/community-robot-lib/githubclient"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/opensourceways/robot-github-openeuler-repo-watcher/models"
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/snapshot"
 )
 
 const (
@@ -11,26 +17,85 @@ const (
 )
 
 type localState struct {
+	org string
+
+	// store is used to delete the snapshots of the forgotten repos. It is nil in dry-run mode.
+	store snapshot.Store
 	repos map[string]*models.Repo
+
+	// declared is the repos which have been declared by the repository files.
+	declared sets.String
+
+	// validatedAt is the time when the state of each repo was loaded from GitHub.
+	validatedAt map[string]time.Time
 }
 
-func (r *localState) getOrNewRepo(repo string) *models.Repo {
-	if v, ok := r.repos[repo]; ok {
-		return v
+func newLocalState(org string, store snapshot.Store) *localState {
+	return &localState{
+		org:         org,
+		store:       store,
+		repos:       make(map[string]*models.Repo),
+		declared:    sets.NewString(),
+		validatedAt: make(map[string]time.Time),
 	}
+}
+
+// emptyLocalState returns an empty state of org. The snapshots are not deleted in dry-run mode.
+func (bot *robot) emptyLocalState(org string) *localState {
+	store := bot.store
+	if bot.plan != nil {
+		store = nil
+	}
+
+	return newLocalState(org, store)
+}
 
-	v := models.NewRepo(repo, models.RepoState{})
+func (r *localState) add(repo string, s models.RepoState, validatedAt time.Time) *models.Repo {
+	v := models.NewRepo(repo, s)
 	r.repos[repo] = v
+	r.validatedAt[repo] = validatedAt
 
 	return v
 }
 
-func (r *localState) clear(isExpectedRepo func(string) bool) {
-	for k := range r.repos {
+func (r *localState) getOrNewRepo(repo string) *models.Repo {
+	r.declared.Insert(repo)
+
+	if v, ok := r.repos[repo]; ok {
+		return v
+	}
+
+	return r.add(repo, models.RepoState{}, time.Now())
+}
+
+// clear forgets the repos which are not expected. It returns the ones which
+// were declared before and not renamed, that is the repos whose repository
+// files are deleted.
+func (r *localState) clear(isExpectedRepo, isRenamedRepo func(string) bool) []*models.Repo {
+	var orphans []*models.Repo
+
+	for k, v := range r.repos {
 		if !isExpectedRepo(k) {
 			delete(r.repos, k)
+			delete(r.validatedAt, k)
+
+			if r.declared.Has(k) {
+				r.declared.Delete(k)
+
+				if !isRenamedRepo(k) {
+					orphans = append(orphans, v)
+				}
+			}
+
+			if r.store != nil {
+				if err := r.store.Delete(r.org, k); err != nil {
+					logrus.Errorf("delete snapshot of repo:%s, err:%s", k, err.Error())
+				}
+			}
 		}
 	}
+
+	return orphans
 }
 
 func (bot *robot) loadALLRepos(org string) (*localState, error) {
@@ -39,38 +104,169 @@ func (bot *robot) loadALLRepos(org string) (*localState, error) {
 		return nil, err
 	}
 
-	r := localState{
-		repos: make(map[string]*models.Repo),
+	r := bot.emptyLocalState(org)
+
+	for _, item := range items {
+		r.add(item.GetName(), bot.toRepoState(item), time.Now())
+	}
+
+	return r, nil
+}
+
+// toRepoState returns the state of the repo listed from GitHub.
+func (bot *robot) toRepoState(item *sdk.Repository) models.RepoState {
+	org, repo := gc.GetOrgRepo(item)
+
+	s := models.RepoState{
+		Available: true,
+		Members:   make([]string, 0),
+		Property:  toRepoProperty(item),
+		Owner:     item.GetOwner().GetLogin(),
+	}
+
+	// get repo's members
+	members, err := bot.cli.ListCollaborator(gc.PRInfo{Org: org, Repo: repo})
+	if err != nil {
+		logrus.Errorf("list collaborators of repo:%s, err:%s", repo, err.Error())
+
+		return s
 	}
 
+	s.Members, s.Permissions = toCollaboratorState(members)
+
+	return s
+}
+
+// loadLocalState restores the states of repos from the snapshot store if possible,
+// and loads the repos which have no snapshot from GitHub. The stale states will be
+// revalidated in background.
+func (bot *robot) loadLocalState(org string, log *logrus.Entry) (*localState, error) {
+	if bot.store == nil {
+		return bot.loadALLRepos(org)
+	}
+
+	items, err := bot.store.LoadAll(org)
+	if err != nil {
+		log.Errorf("load snapshots of org(%s) failed, err:%s", org, err.Error())
+	}
+
+	if len(items) == 0 {
+		return bot.loadALLRepos(org)
+	}
+
+	repos, err := bot.cli.GetRepos(org)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]*sdk.Repository, len(repos))
+	for _, item := range repos {
+		existing[item.GetName()] = item
+	}
+
+	// only the states of the declared repos are saved.
+	r := bot.emptyLocalState(org)
+
 	for i := range items {
-		item := items[i]
-		org, repo := gc.GetOrgRepo(item)
-		// get repo's members
-		m := make([]string, 0)
-		members, err := bot.cli.ListCollaborator(gc.PRInfo{Org: org, Repo: repo})
-		if err != nil {
-			r.repos[*item.Name] = models.NewRepo(*item.Name, models.RepoState{
-				Available: true,
-				Members:   m,
-				Property: models.RepoProperty{
-					Private: *item.Private,
-				},
-				Owner: *item.Owner.Login,
-			})
+		item := &items[i]
+
+		// the repo which has been transferred to the attic org is not in the org.
+		if _, ok := existing[item.Repo]; !ok && item.State.Property.AtticOrg == "" {
+			log.Infof("repo:%s in snapshot doesn't exist, forget it", item.Repo)
+
+			continue
 		}
-		for _, i := range members {
-			m = append(m, *i.Login)
+
+		r.add(item.Repo, item.State, item.SavedAt)
+		r.declared.Insert(item.Repo)
+	}
+
+	n := len(r.repos)
+
+	for name, item := range existing {
+		if _, ok := r.repos[name]; !ok {
+			r.add(name, bot.toRepoState(item), time.Now())
 		}
-		r.repos[*item.Name] = models.NewRepo(*item.Name, models.RepoState{
-			Available: true,
-			Members:   toLowerOfMembers(m),
-			Property: models.RepoProperty{
-				Private: *item.Private,
-			},
-			Owner: *item.Owner.Login,
-		})
 	}
 
-	return &r, nil
+	log.Infof(
+		"restore %d repos of org(%s) from snapshot, load %d repos from GitHub",
+		n, org, len(r.repos)-n,
+	)
+
+	bot.revalidateStale(r, log)
+
+	return r, nil
+}
+
+// revalidateStale revalidates the repos whose states have not been validated
+// against GitHub for the ttl of snapshot.
+func (bot *robot) revalidateStale(r *localState, log *logrus.Entry) {
+	ttl := time.Duration(bot.cfg.Snapshot.TTL) * time.Minute
+	if bot.store == nil || ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+
+	for name, v := range r.repos {
+		if now.Sub(r.validatedAt[name]) > ttl {
+			r.validatedAt[name] = now
+
+			bot.revalidate(r.org, v, log)
+		}
+	}
+}
+
+// revalidate reloads the state of repo from GitHub. The states which only the watcher
+// knows are kept.
+func (bot *robot) revalidate(org string, repo *models.Repo, log *logrus.Entry) {
+	name := repo.Name()
+
+	f := func(before models.RepoState) models.RepoState {
+		if !before.Available {
+			return before
+		}
+
+		s, ok := bot.getRepoState(org, name, log)
+		if !ok {
+			return before
+		}
+
+		s.UndeclaredBranches = before.UndeclaredBranches
+		s.Teams = before.Teams
+		s.CodeOwnersHash = before.CodeOwnersHash
+		s.Property.CommentLimitExpiresAt = before.Property.CommentLimitExpiresAt
+		s.Property.ManagedTopics = before.Property.ManagedTopics
+		s.Property.AtticOrg = before.Property.AtticOrg
+		s.Property.Recycled = before.Property.Recycled
+		s.Property.MissingDefaultBranch = before.Property.MissingDefaultBranch
+
+		bot.saveSnapshot(org, name, s, log)
+
+		return s
+	}
+
+	err := bot.submit(func() {
+		repo.Update(f)
+	})
+	if err != nil {
+		log.Errorf("submit task of revalidating repo:%s, err:%s", name, err.Error())
+	}
+}
+
+func (bot *robot) saveSnapshot(org, repo string, s models.RepoState, log *logrus.Entry) {
+	if bot.store == nil || bot.plan != nil {
+		return
+	}
+
+	err := bot.store.Save(&snapshot.Snapshot{
+		Org:     org,
+		Repo:    repo,
+		State:   s,
+		SavedAt: time.Now(),
+	})
+	if err != nil {
+		log.Errorf("save snapshot of repo:%s, err:%s", repo, err.Error())
+	}
 }
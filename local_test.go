@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	sdk "github.com/google/go-github/v36/github"
+	gc "github.com/opensourceways/community-robot-lib/githubclient"
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/models"
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/snapshot"
+)
+
+type localClient struct {
+	iClient
+
+	repos []string
+}
+
+func (c *localClient) GetRepos(org string) ([]*sdk.Repository, error) {
+	r := make([]*sdk.Repository, 0, len(c.repos))
+	for i := range c.repos {
+		r = append(r, &sdk.Repository{
+			Name:  sdk.String(c.repos[i]),
+			Owner: &sdk.User{Login: sdk.String(org)},
+		})
+	}
+
+	return r, nil
+}
+
+func (c *localClient) ListCollaborator(pr gc.PRInfo) ([]*sdk.User, error) {
+	return []*sdk.User{{Login: sdk.String("Tom")}}, nil
+}
+
+type memStore struct {
+	items []snapshot.Snapshot
+}
+
+func (s *memStore) Save(v *snapshot.Snapshot) error { return nil }
+func (s *memStore) Delete(org, repo string) error   { return nil }
+func (s *memStore) LoadAll(org string) ([]snapshot.Snapshot, error) {
+	return s.items, nil
+}
+
+func TestLoadLocalState(t *testing.T) {
+	store := &memStore{items: []snapshot.Snapshot{
+		{Org: "src-openeuler", Repo: "a", State: models.RepoState{Available: true}, SavedAt: time.Now()},
+		{Org: "src-openeuler", Repo: "c", State: models.RepoState{Available: true}, SavedAt: time.Now()},
+	}}
+
+	bot := &robot{
+		cli:   &localClient{repos: []string{"a", "b"}},
+		store: store,
+		cfg:   &botConfig{},
+	}
+
+	r, err := bot.loadLocalState("src-openeuler", logrus.NewEntry(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.repos) != 2 || r.repos["a"] == nil || r.repos["b"] == nil {
+		t.Fatalf("unexpected repos: %v", r.repos)
+	}
+
+	if !r.declared.Has("a") || r.declared.Has("b") {
+		t.Errorf("unexpected declared repos: %v", r.declared.List())
+	}
+
+	r.repos["b"].Update(func(s models.RepoState) models.RepoState {
+		if !s.Available || len(s.Members) != 1 || s.Members[0] != "tom" {
+			t.Errorf("unexpected state of repo loaded from GitHub: %v", s)
+		}
+
+		return s
+	})
+}
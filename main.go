@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
@@ -11,17 +14,24 @@ import (
 
 	"github.com/opensourceways/community-robot-lib/config"
 	"github.com/opensourceways/community-robot-lib/giteeclient"
-	"github.com/opensourceways/community-robot-lib/githubclient"
 	"github.com/opensourceways/community-robot-lib/logrusutil"
 	liboptions "github.com/opensourceways/community-robot-lib/options"
 	"github.com/opensourceways/community-robot-lib/secret"
 	"github.com/panjf2000/ants/v2"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/snapshot"
 )
 
 type options struct {
 	github     liboptions.GithubOptions
 	configFile string
+	port       int
+	// webhookSecretFile is the file including the password of the Gitee webhook.
+	webhookSecretFile string
+	dryRun            bool
+	planFile          string
 }
 
 func (o *options) Validate() error {
@@ -34,6 +44,10 @@ func gatherOptions(fs *flag.FlagSet, args ...string) options {
 	o.github.AddFlags(fs)
 
 	fs.StringVar(&o.configFile, "config-file", "", "Path to config file.")
+	fs.IntVar(&o.port, "port", 8888, "Port to serve metrics and health probes on. 0 means not to serve.")
+	fs.StringVar(&o.webhookSecretFile, "webhook-secret-file", "", "Path to the file including the password of Gitee push webhook. Unset means not to accept webhook.")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Check the repos once and print the plan of changes instead of applying them.")
+	fs.StringVar(&o.planFile, "plan-file", "", "Path to the file which the plan will be written to in dry-run mode. Default is stdout.")
 
 	_ = fs.Parse(args)
 	return o
@@ -47,10 +61,26 @@ func main() {
 		logrus.WithError(err).Fatal("Invalid options")
 	}
 
-	cfg, err := getConfig(o.configFile)
+	agent, err := startConfigAgent(o.configFile)
 	if err != nil {
 		logrus.WithError(err).Fatal("Error getting config.")
 	}
+	defer agent.Stop()
+
+	loadConfig := func() (string, *botConfig) {
+		v, c := agent.GetConfig()
+		if cfg, ok := c.(*configuration); ok {
+			return v, &cfg.Config
+		}
+
+		return "", nil
+	}
+
+	version, latest := loadConfig()
+	if latest == nil {
+		logrus.Fatal("Error getting config: can't convert the configuration.")
+	}
+	cfg := latest
 
 	c, err := genClient(o.github.TokenPath)
 	if err != nil {
@@ -69,9 +99,67 @@ func main() {
 	}
 	defer pool.Release()
 
-	p := newRobot(c, ge, pool, NewOMService(cfg.OMApi), &cfg)
+	registerMetrics(pool)
+
+	c = newMetricsClient(c)
+
+	var pl *plan
+	if o.dryRun {
+		changesNotApplied = true
+
+		pl = newPlan()
+		c = newDryRunClient(c, pl)
+	}
+
+	om := newCachedOMService(NewOMService(cfg.OMApi), cfg.OMApi)
+
+	p := newRobot(c, ge, pool, om, cfg)
+	p.plan = pl
+	p.loadConfig = loadConfig
+	p.configVersion = version
+	p.health = newHealthState(cfg.livenessTimeout())
+
+	if f := cfg.IdentityMappingFile; f != "" {
+		p.identities = newIdentityMapping(f)
+		if err := p.identities.refresh(); err != nil {
+			logrus.WithError(err).Fatal("Error loading identity mapping.")
+		}
+	}
+
+	if dir := cfg.Snapshot.Dir; dir != "" {
+		if p.store, err = snapshot.NewFileStore(dir); err != nil {
+			logrus.WithError(err).Fatal("Error initializing snapshot store.")
+		}
+	}
+
+	if o.port > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		mux.HandleFunc("/healthz", p.health.healthz)
+		mux.HandleFunc("/readyz", p.health.readyz)
+
+		if o.webhookSecretFile != "" {
+			secret, err := ioutil.ReadFile(o.webhookSecretFile)
+			if err != nil {
+				logrus.WithError(err).Fatal("Error reading webhook secret.")
+			}
+
+			mux.Handle("/gitee-hook", &webhookHandler{
+				bot:    p,
+				secret: bytes.TrimSpace(secret),
+			})
+		}
+
+		go serve(o.port, mux)
+	}
 
 	run(p)
+
+	if pl != nil {
+		if err := writePlan(pl, o.planFile); err != nil {
+			logrus.WithError(err).Error("Error writing plan.")
+		}
+	}
 }
 
 func newPool(size int, log ants.Logger) (*ants.Pool, error) {
@@ -86,23 +174,24 @@ func (l logWapper) Printf(format string, args ...interface{}) {
 	logrus.Infof(format, args...)
 }
 
-func getConfig(configFile string) (botConfig, error) {
+func serve(port int, handler http.Handler) {
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), handler); err != nil {
+		logrus.WithError(err).Error("Error serving http.")
+	}
+}
+
+// startConfigAgent loads the config file and keeps reloading it periodically.
+// The changed config is rejected if it is invalid.
+func startConfigAgent(configFile string) (*config.ConfigAgent, error) {
 	agent := config.NewConfigAgent(func() config.Config {
 		return &configuration{}
 	})
 
 	if err := agent.Start(configFile); err != nil {
-		return botConfig{}, err
+		return nil, err
 	}
 
-	agent.Stop()
-
-	_, v := agent.GetConfig()
-
-	if cfg, ok := v.(*configuration); ok {
-		return cfg.Config, nil
-	}
-	return botConfig{}, fmt.Errorf("can't convert the configuration")
+	return &agent, nil
 }
 
 func genClient(tokenPath string) (iClient, error) {
@@ -115,7 +204,7 @@ func genClient(tokenPath string) (iClient, error) {
 	secretAgent.Stop()
 
 	t := secretAgent.GetTokenGenerator(tokenPath)
-	return githubclient.NewClient(t), nil
+	return newGHClient(t), nil
 }
 
 func genGiteeClient(tokenPath string) (geClient, error) {
@@ -131,6 +220,20 @@ func genGiteeClient(tokenPath string) (geClient, error) {
 	return giteeclient.NewClient(t), nil
 }
 
+func writePlan(p *plan, planFile string) error {
+	if planFile == "" {
+		return p.write(os.Stdout)
+	}
+
+	f, err := os.Create(planFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return p.write(f)
+}
+
 func run(bot *robot) {
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"time"
+
+	sdk "github.com/google/go-github/v36/github"
+	gc "github.com/opensourceways/community-robot-lib/githubclient"
+	"github.com/panjf2000/ants/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "repo_watcher"
+
+const (
+	changeRepoCreated     = "repo_created"
+	changeRepoRenamed     = "repo_renamed"
+	changeRepoArchived    = "repo_archived"
+	changeRepoRevived     = "repo_revived"
+	changeRepoTransferred = "repo_transferred"
+	changeRepoUpdated     = "repo_updated"
+	changeBranchCreated   = "branch_created"
+	changeBranchProtected = "branch_protected"
+	changeBranchDeleted   = "branch_deleted"
+	changeBranchRenamed   = "branch_renamed"
+	changeDefaultBranch   = "default_branch_updated"
+	changeMemberAdded     = "member_added"
+	changeMemberRemoved   = "member_removed"
+	changeMemberUpdated   = "member_permission_updated"
+
+	changeCodeOwnersUpdated = "codeowners_updated"
+	changeTeamCreated       = "team_created"
+	changeTeamMemberAdded   = "team_member_added"
+	changeTeamMemberRemoved = "team_member_removed"
+	changeTeamRepoUpdated   = "team_repo_updated"
+	changeTeamRepoRemoved   = "team_repo_removed"
+)
+
+var (
+	checkDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "check_duration_seconds",
+		Help:      "Duration of a check cycle over all the repos.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	})
+
+	lastCheckTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_check_timestamp_seconds",
+		Help:      "Unix time when the last check cycle finished.",
+	})
+
+	reposChecked = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "repos_checked_total",
+		Help:      "Number of repos which have been checked.",
+	})
+
+	changesApplied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "changes_total",
+		Help:      "Number of changes applied to GitHub.",
+	}, []string{"change"})
+
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_api_errors_total",
+		Help:      "Number of failed GitHub API calls.",
+	}, []string{"operation"})
+
+	omLookupFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "om_lookup_failures_total",
+		Help:      "Number of failed lookups of user info from OM service.",
+	})
+
+	pendingTasks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "pool_pending_tasks",
+		Help:      "Number of tasks which are submitted but not started yet.",
+	})
+)
+
+func registerMetrics(pool *ants.Pool) {
+	prometheus.MustRegister(
+		checkDuration,
+		lastCheckTimestamp,
+		reposChecked,
+		changesApplied,
+		apiErrors,
+		omLookupFailures,
+		pendingTasks,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "pool_running_workers",
+			Help:      "Number of the running workers of pool.",
+		}, func() float64 {
+			return float64(pool.Running())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "pool_capacity",
+			Help:      "Capacity of pool.",
+		}, func() float64 {
+			return float64(pool.Cap())
+		}),
+	)
+}
+
+// changesNotApplied means the changes are only planned in dry-run mode, so they are not counted.
+var changesNotApplied bool
+
+func recordChange(change string) {
+	if !changesNotApplied {
+		changesApplied.WithLabelValues(change).Inc()
+	}
+}
+
+// metricsClient counts the failed calls of each GitHub API.
+type metricsClient struct {
+	cli iClient
+}
+
+func newMetricsClient(cli iClient) *metricsClient {
+	return &metricsClient{cli: cli}
+}
+
+func (m *metricsClient) observe(op string, err error) error {
+	if err != nil {
+		apiErrors.WithLabelValues(op).Inc()
+	}
+
+	return err
+}
+
+func (m *metricsClient) SetProtectionBranch(org, repo, branch string, pre *sdk.ProtectionRequest) error {
+	return m.observe("SetProtectionBranch", m.cli.SetProtectionBranch(org, repo, branch, pre))
+}
+
+func (m *metricsClient) GetDirectoryTree(org, repo, branch string, recursive bool) ([]*sdk.TreeEntry, error) {
+	v, err := m.cli.GetDirectoryTree(org, repo, branch, recursive)
+	return v, m.observe("GetDirectoryTree", err)
+}
+
+func (m *metricsClient) GetPathContent(org, repo, path, branch string) (*sdk.RepositoryContent, error) {
+	v, err := m.cli.GetPathContent(org, repo, path, branch)
+	return v, m.observe("GetPathContent", err)
+}
+
+func (m *metricsClient) CreateFile(org, repo, path, branch, commitMSG, sha string, content []byte) error {
+	return m.observe("CreateFile", m.cli.CreateFile(org, repo, path, branch, commitMSG, sha, content))
+}
+
+func (m *metricsClient) GetRepos(org string) ([]*sdk.Repository, error) {
+	v, err := m.cli.GetRepos(org)
+	return v, m.observe("GetRepos", err)
+}
+
+func (m *metricsClient) GetRepo(org, repo string) (*sdk.Repository, error) {
+	v, err := m.cli.GetRepo(org, repo)
+	return v, m.observe("GetRepo", err)
+}
+
+func (m *metricsClient) CreateRepo(org string, r *sdk.Repository) error {
+	return m.observe("CreateRepo", m.cli.CreateRepo(org, r))
+}
+
+func (m *metricsClient) UpdateRepo(org, repo string, r *sdk.Repository) error {
+	return m.observe("UpdateRepo", m.cli.UpdateRepo(org, repo, r))
+}
+
+func (m *metricsClient) ListCollaborator(pr gc.PRInfo) ([]*sdk.User, error) {
+	v, err := m.cli.ListCollaborator(pr)
+	return v, m.observe("ListCollaborator", err)
+}
+
+func (m *metricsClient) RemoveProtectionBranch(org, repo, branch string) error {
+	return m.observe("RemoveProtectionBranch", m.cli.RemoveProtectionBranch(org, repo, branch))
+}
+
+func (m *metricsClient) GetRef(org, repo, ref string) (*sdk.Reference, error) {
+	v, err := m.cli.GetRef(org, repo, ref)
+	return v, m.observe("GetRef", err)
+}
+
+func (m *metricsClient) CreateBranch(org, repo string, reference *sdk.Reference) error {
+	return m.observe("CreateBranch", m.cli.CreateBranch(org, repo, reference))
+}
+
+func (m *metricsClient) ListBranches(org, repo string) ([]*sdk.Branch, error) {
+	v, err := m.cli.ListBranches(org, repo)
+	return v, m.observe("ListBranches", err)
+}
+
+func (m *metricsClient) RemoveRepoMember(pr gc.PRInfo, login string) error {
+	return m.observe("RemoveRepoMember", m.cli.RemoveRepoMember(pr, login))
+}
+
+func (m *metricsClient) GetBranchProtection(org, repo, branch string) (*sdk.Protection, error) {
+	v, err := m.cli.GetBranchProtection(org, repo, branch)
+	return v, m.observe("GetBranchProtection", err)
+}
+
+func (m *metricsClient) DeleteBranch(org, repo, branch string) error {
+	return m.observe("DeleteBranch", m.cli.DeleteBranch(org, repo, branch))
+}
+
+func (m *metricsClient) RenameBranch(org, repo, branch, newName string) error {
+	return m.observe("RenameBranch", m.cli.RenameBranch(org, repo, branch, newName))
+}
+
+func (m *metricsClient) HasOpenPR(org, repo, branch string) (bool, error) {
+	v, err := m.cli.HasOpenPR(org, repo, branch)
+	return v, m.observe("HasOpenPR", err)
+}
+
+func (m *metricsClient) TransferRepo(org, repo, newOrg string) error {
+	return m.observe("TransferRepo", m.cli.TransferRepo(org, repo, newOrg))
+}
+
+func (m *metricsClient) ReplaceTopics(org, repo string, topics []string) error {
+	return m.observe("ReplaceTopics", m.cli.ReplaceTopics(org, repo, topics))
+}
+
+func (m *metricsClient) GetInteractionLimit(org, repo string) (time.Time, error) {
+	v, err := m.cli.GetInteractionLimit(org, repo)
+	return v, m.observe("GetInteractionLimit", err)
+}
+
+func (m *metricsClient) SetInteractionLimit(org, repo, limit, expiry string) (time.Time, error) {
+	v, err := m.cli.SetInteractionLimit(org, repo, limit, expiry)
+	return v, m.observe("SetInteractionLimit", err)
+}
+
+func (m *metricsClient) RemoveInteractionLimit(org, repo string) error {
+	return m.observe("RemoveInteractionLimit", m.cli.RemoveInteractionLimit(org, repo))
+}
+
+func (m *metricsClient) GetTeam(org, slug string) (*sdk.Team, error) {
+	v, err := m.cli.GetTeam(org, slug)
+	return v, m.observe("GetTeam", err)
+}
+
+func (m *metricsClient) CreateTeam(org, name, description string) (*sdk.Team, error) {
+	v, err := m.cli.CreateTeam(org, name, description)
+	return v, m.observe("CreateTeam", err)
+}
+
+func (m *metricsClient) ListTeamMembers(org, slug string) ([]*sdk.User, error) {
+	v, err := m.cli.ListTeamMembers(org, slug)
+	return v, m.observe("ListTeamMembers", err)
+}
+
+func (m *metricsClient) AddTeamMember(org, slug, login string) error {
+	return m.observe("AddTeamMember", m.cli.AddTeamMember(org, slug, login))
+}
+
+func (m *metricsClient) RemoveTeamMember(org, slug, login string) error {
+	return m.observe("RemoveTeamMember", m.cli.RemoveTeamMember(org, slug, login))
+}
+
+func (m *metricsClient) AddTeamRepo(org, slug, repo, permission string) error {
+	return m.observe("AddTeamRepo", m.cli.AddTeamRepo(org, slug, repo, permission))
+}
+
+func (m *metricsClient) RemoveTeamRepo(org, slug, repo string) error {
+	return m.observe("RemoveTeamRepo", m.cli.RemoveTeamRepo(org, slug, repo))
+}
+
+func (m *metricsClient) AddRepoMember(pr gc.PRInfo, login, permission string) error {
+	return m.observe("AddRepoMember", m.cli.AddRepoMember(pr, login, permission))
+}
@@ -1,21 +1,71 @@
 package models
 
-import "github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
+import (
+	"time"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
+)
 
 var empty = struct{}{}
 
 type RepoProperty struct {
-	Private    bool
-	CanComment bool
+	Private     bool     `json:"private"`
+	CanComment  bool     `json:"can_comment"`
+	Archived    bool     `json:"archived,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Homepage    string   `json:"homepage,omitempty"`
+	Topics      []string `json:"topics,omitempty"`
+
+	// ManagedTopics is the topics which are set by the watcher. The other topics
+	// of the repo are kept.
+	ManagedTopics []string `json:"managed_topics,omitempty"`
+
+	Settings community.RepoSettings `json:"settings"`
+
+	// CommentLimitExpiresAt is the time when the interaction limit of the repo which
+	// is not commentable expires. It is unknown if it is zero and CanComment is false.
+	CommentLimitExpiresAt time.Time `json:"comment_limit_expires_at,omitempty"`
+
+	// AtticOrg is the org which the recycled repo has been transferred to.
+	AtticOrg string `json:"attic_org,omitempty"`
+
+	// MissingDefaultBranch is the expected default branch which doesn't exist in the repo.
+	// It is used to warn only once.
+	MissingDefaultBranch string `json:"missing_default_branch,omitempty"`
+
+	// Recycled means the repo has been archived by the watcher because it belongs to sig-recycle.
+	Recycled bool `json:"recycled,omitempty"`
+}
+
+// IsRecycled returns true if the repo has been recycled by the watcher. The repo archived
+// by others is not regarded as recycled.
+func (p *RepoProperty) IsRecycled() bool {
+	return p.Recycled || p.AtticOrg != ""
 }
 
 type RepoState struct {
-	Available bool
-	Branches  []community.RepoBranch
-	Members   []string
-	Admins    []string
-	Owner     string
-	Property  RepoProperty
+	Available bool                   `json:"available"`
+	Branches  []community.RepoBranch `json:"branches,omitempty"`
+	Members   []string               `json:"members,omitempty"`
+	Owner     string                 `json:"owner,omitempty"`
+	Property  RepoProperty           `json:"property"`
+
+	// Permissions is the login -> permission of the members
+	Permissions map[string]string `json:"permissions"`
+
+	// UndeclaredBranches is the branch -> the time when it was found not declared
+	// in the repository file. It is used to delete the branch after a grace period.
+	UndeclaredBranches map[string]time.Time `json:"undeclared_branches,omitempty"`
+
+	// Teams is the slug -> permission of the teams which are granted to the repo.
+	Teams map[string]string `json:"teams,omitempty"`
+
+	// ProtectionCheckedAt is the time when the protection rules of the branches were
+	// compared with the live ones last time.
+	ProtectionCheckedAt time.Time `json:"protection_checked_at,omitempty"`
+
+	// CodeOwnersHash is the hash of the content of CODEOWNERS which was written last time.
+	CodeOwnersHash string `json:"codeowners_hash,omitempty"`
 }
 
 type Repo struct {
@@ -32,6 +82,10 @@ func NewRepo(repo string, state RepoState) *Repo {
 	}
 }
 
+func (r *Repo) Name() string {
+	return r.name
+}
+
 func (r *Repo) Update(f func(RepoState) RepoState) {
 	select {
 	case r.start <- empty:
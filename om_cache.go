@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type identityCacheItem struct {
+	identities []Identities
+	expiry     time.Time
+}
+
+// omCall is an in-flight lookup which the concurrent callers share.
+type omCall struct {
+	wg         sync.WaitGroup
+	identities []Identities
+	err        error
+}
+
+// cachedOMService caches the identities of users and deduplicates
+// the concurrent lookups of the same user.
+type cachedOMService struct {
+	OMService
+
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	lock  sync.Mutex
+	cache map[string]identityCacheItem
+	calls map[string]*omCall
+}
+
+func newCachedOMService(o OMService, cfg OMApi) *cachedOMService {
+	return &cachedOMService{
+		OMService:   o,
+		ttl:         time.Duration(cfg.CacheTTL) * time.Minute,
+		negativeTTL: time.Duration(cfg.NegativeCacheTTL) * time.Minute,
+		cache:       make(map[string]identityCacheItem),
+		calls:       make(map[string]*omCall),
+	}
+}
+
+func (c *cachedOMService) GetUserInfo(giteeId string) ([]Identities, error) {
+	c.lock.Lock()
+
+	if item, ok := c.cache[giteeId]; ok && time.Now().Before(item.expiry) {
+		c.lock.Unlock()
+
+		return item.identities, nil
+	}
+
+	if call, ok := c.calls[giteeId]; ok {
+		c.lock.Unlock()
+
+		call.wg.Wait()
+
+		return call.identities, call.err
+	}
+
+	call := new(omCall)
+	call.wg.Add(1)
+	c.calls[giteeId] = call
+
+	c.lock.Unlock()
+
+	call.identities, call.err = c.OMService.GetUserInfo(giteeId)
+	call.wg.Done()
+
+	c.lock.Lock()
+	delete(c.calls, giteeId)
+
+	// don't cache the error, so that it can be retried next time.
+	if call.err == nil {
+		ttl := c.ttl
+		if len(call.identities) == 0 {
+			ttl = c.negativeTTL
+		}
+
+		c.cache[giteeId] = identityCacheItem{
+			identities: call.identities,
+			expiry:     time.Now().Add(ttl),
+		}
+	}
+
+	c.lock.Unlock()
+
+	return call.identities, call.err
+}
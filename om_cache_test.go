@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingOMService struct {
+	omServiceTest
+
+	calls int32
+}
+
+func (o *countingOMService) GetUserInfo(giteeId string) ([]Identities, error) {
+	atomic.AddInt32(&o.calls, 1)
+	time.Sleep(10 * time.Millisecond)
+
+	return o.omServiceTest.GetUserInfo(giteeId)
+}
+
+func TestCachedOMService(t *testing.T) {
+	o := new(countingOMService)
+	c := newCachedOMService(o, OMApi{CacheTTL: 10, NegativeCacheTTL: 10})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			v, err := c.GetUserInfo("tom-gitee")
+			if err != nil || len(v) != 2 {
+				t.Errorf("unexpected result: %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := c.GetUserInfo("xxxxxxx"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetUserInfo("xxxxxxx"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&o.calls); n != 2 {
+		t.Errorf("expect 2 lookups, but got %d", n)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/models"
+)
+
+// handleOrphanRepo applies the orphan policy to the repo whose repository file is deleted.
+func (bot *robot) handleOrphanRepo(org string, repo *models.Repo, log *logrus.Entry) {
+	name := repo.Name()
+	action := bot.cfg.Orphan.Action
+
+	switch action {
+	case orphanIgnore:
+		return
+	case orphanReport:
+		log.Warningf("the repository file of repo:%s/%s is deleted", org, name)
+		return
+	}
+
+	log = log.WithField(action+" orphan repo", name)
+
+	f := func(before models.RepoState) models.RepoState {
+		if !before.Available || before.Property.Archived || before.Property.IsRecycled() {
+			return before
+		}
+
+		log.Info("start")
+
+		if action == orphanArchive {
+			if err := bot.setArchived(org, name, true); err != nil {
+				log.Error(err)
+			} else {
+				before.Property.Archived = true
+				recordChange(changeRepoArchived)
+			}
+		} else {
+			// only the collaborators which the watcher knows are removed.
+			if len(before.Members) == 0 || before.Permissions == nil {
+				log.Info("no collaborators are recorded")
+
+				return before
+			}
+
+			before.Members, before.Permissions, _ = bot.removeCollaborators(
+				org, name, before.Members, before.Permissions, &before.Owner, permissionPull, log,
+			)
+		}
+
+		return before
+	}
+
+	// the repo has been forgotten, so the state is not saved.
+	err := bot.submit(func() {
+		repo.Update(f)
+	})
+	if err != nil {
+		log.Errorf("submit task, err:%s", err.Error())
+	}
+}
+
+type orphanRepo struct {
+	Name     string `json:"name"`
+	Archived bool   `json:"archived,omitempty"`
+}
+
+// reportOrphanRepos writes the repos of org which are not declared by any repository file
+// to the report file periodically.
+func (bot *robot) reportOrphanRepos(w *watcher, log *logrus.Entry) {
+	org := w.target.GithubOrg
+	reportFile := bot.cfg.orphanReportFile(org)
+	if reportFile == "" || bot.plan != nil {
+		return
+	}
+
+	if time.Since(w.orphanReportAt) < time.Duration(bot.cfg.Orphan.ReportInterval)*time.Minute {
+		return
+	}
+
+	declared := w.expect.reposInfo.GetRepos()
+	if len(declared) == 0 {
+		return
+	}
+
+	items, err := bot.cli.GetRepos(org)
+	if err != nil {
+		log.Errorf("list repos of org:%s for orphan report, err:%s", org, err.Error())
+		return
+	}
+
+	orphans := make([]orphanRepo, 0)
+	for _, item := range items {
+		if _, ok := declared[item.GetName()]; !ok {
+			orphans = append(orphans, orphanRepo{
+				Name:     item.GetName(),
+				Archived: item.GetArchived(),
+			})
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Name < orphans[j].Name
+	})
+
+	w.orphanReportAt = time.Now()
+
+	log.Infof("%d repos of org:%s are not declared by any repository file", len(orphans), org)
+
+	b, err := json.MarshalIndent(struct {
+		GeneratedAt time.Time    `json:"generated_at"`
+		Org         string       `json:"org"`
+		Repos       []orphanRepo `json:"repos"`
+	}{
+		GeneratedAt: w.orphanReportAt,
+		Org:         org,
+		Repos:       orphans,
+	}, "", "  ")
+	if err != nil {
+		log.Errorf("marshal orphan repos, err:%s", err.Error())
+		return
+	}
+
+	if err := ioutil.WriteFile(reportFile, b, 0644); err != nil {
+		log.Errorf("write orphan repos to %s, err:%s", reportFile, err.Error())
+	}
+}
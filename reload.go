@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// configLoader returns the latest valid configuration and its version.
+type configLoader func() (string, *botConfig)
+
+// the max times of trying to prepare a new target when reloading the configuration
+const reloadPrepareAttempts = 3
+
+// reloadConfig applies the latest configuration if it has changed. The invalid one
+// has been rejected by the config agent, so the previous one is kept in that case.
+// It waits for the running tasks first, so that no task sees a half-applied configuration.
+// The configuration is applied only after the new targets are prepared, otherwise the
+// previous one is kept and it will be applied again next time.
+func (bot *robot) reloadConfig(ctx context.Context, log *logrus.Entry) {
+	if bot.loadConfig == nil {
+		return
+	}
+
+	v, cfg := bot.loadConfig()
+	if cfg == nil || v == bot.configVersion {
+		return
+	}
+
+	log.Info("the configuration has changed, apply it")
+
+	bot.wg.Wait()
+
+	ws, err := bot.reloadWatchers(ctx, cfg, log)
+	if err != nil {
+		log.Errorf("apply the configuration, err:%s", err.Error())
+		return
+	}
+
+	old := bot.cfg
+	bot.cfg = cfg
+	bot.configVersion = v
+
+	if cfg.ConcurrentSize != old.ConcurrentSize {
+		bot.pool.Tune(cfg.ConcurrentSize)
+	}
+
+	if cfg.OMApi != old.OMApi {
+		bot.om = newCachedOMService(NewOMService(cfg.OMApi), cfg.OMApi)
+	}
+
+	if f := cfg.IdentityMappingFile; f != old.IdentityMappingFile {
+		bot.identities = nil
+		if f != "" {
+			bot.identities = newIdentityMapping(f)
+		}
+	}
+
+	if cfg.Snapshot.Dir != old.Snapshot.Dir {
+		log.Warning("the change of snapshot dir will take effect after restart")
+	}
+
+	bot.health.setTimeout(cfg.livenessTimeout())
+
+	bot.setWatchers(ws)
+
+	// the events of the previous watchers are stale, and the next check will cover them.
+	bot.drainEvents()
+}
+
+// reloadWatchers returns the watchers of the targets of cfg. It keeps the states of
+// the targets which are still watched, and prepares the new ones. It returns error
+// if failed to prepare any of them.
+func (bot *robot) reloadWatchers(ctx context.Context, cfg *botConfig, log *logrus.Entry) ([]*watcher, error) {
+	current := bot.getWatchers()
+	old := make(map[string]*watcher, len(current))
+	for _, w := range current {
+		old[w.target.GithubOrg] = w
+	}
+
+	ws := make([]*watcher, 0, len(cfg.Targets))
+
+	for i := range cfg.Targets {
+		t := &cfg.Targets[i]
+		w := &watcher{target: t}
+
+		o, ok := old[t.GithubOrg]
+		if ok && o.target.watchingFiles == t.watchingFiles {
+			w.local = o.local
+			w.expect = o.expect
+			w.orphanReportAt = o.orphanReportAt
+		} else {
+			log.Infof("start watching org:%s", t.GithubOrg)
+
+			if err := bot.prepare(ctx, w, reloadPrepareAttempts, log); err != nil {
+				return nil, err
+			}
+		}
+
+		ws = append(ws, w)
+	}
+
+	return ws, nil
+}
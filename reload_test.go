@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestReloadConfig(t *testing.T) {
+	newCfg := func(size int) *botConfig {
+		cfg := &botConfig{
+			ConcurrentSize: size,
+			WatchingFiles: watchingFiles{
+				repoBranch: repoBranch{Org: "openeuler", Repo: "community", Branch: "master"},
+				RepoOrg:    "src-openeuler",
+				SigDir:     "sig",
+			},
+		}
+		cfg.setDefault()
+
+		return cfg
+	}
+
+	pool, err := newPool(1, logWapper{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Release()
+
+	cfg := newCfg(1)
+	bot := newRobot(nil, nil, pool, nil, cfg)
+	bot.configVersion = "v1"
+
+	local := &localState{org: "src-openeuler"}
+	bot.watchers[0].local = local
+	bot.watchers[0].expect = &expectState{log: logrus.NewEntry(logrus.New())}
+
+	version, latest := "v1", cfg
+	bot.loadConfig = func() (string, *botConfig) {
+		return version, latest
+	}
+
+	log := logrus.NewEntry(logrus.New())
+
+	version, latest = "v2", newCfg(3)
+	bot.reloadConfig(context.Background(), log)
+
+	if bot.configVersion != "v2" || bot.cfg != latest {
+		t.Errorf("the configuration is not applied")
+	}
+
+	if v := pool.Cap(); v != 3 {
+		t.Errorf("unexpected pool size: %d", v)
+	}
+
+	if w := bot.getWatchers(); len(w) != 1 || w[0].local != local || w[0].target != &latest.Targets[0] {
+		t.Errorf("the state of watcher is not kept")
+	}
+}
@@ -2,15 +2,22 @@ package main
 
 import (
 	"sync"
+	"time"
 
 	sdk "github.com/google/go-github/v36/github"
 	gc "github.com/opensourceways/community-robot-lib/githubclient"
 	gesdk "github.com/opensourceways/go-gitee/gitee"
 
 	"github.com/panjf2000/ants/v2"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/snapshot"
 )
 
-const botName = "repo-watcher"
+const (
+	botName = "repo-watcher"
+
+	maxPendingEvents = 100
+)
 
 type iClient interface {
 	SetProtectionBranch(org, repo, branch string, pre *sdk.ProtectionRequest) error
@@ -28,15 +35,46 @@ type iClient interface {
 	ListBranches(org, repo string) ([]*sdk.Branch, error)
 	RemoveRepoMember(pr gc.PRInfo, login string) error
 	AddRepoMember(pr gc.PRInfo, login, permission string) error
+	GetBranchProtection(org, repo, branch string) (*sdk.Protection, error)
+	DeleteBranch(org, repo, branch string) error
+	RenameBranch(org, repo, branch, newName string) error
+	HasOpenPR(org, repo, branch string) (bool, error)
+	TransferRepo(org, repo, newOrg string) error
+	ReplaceTopics(org, repo string, topics []string) error
+	GetInteractionLimit(org, repo string) (time.Time, error)
+	SetInteractionLimit(org, repo, limit, expiry string) (time.Time, error)
+	RemoveInteractionLimit(org, repo string) error
+	GetTeam(org, slug string) (*sdk.Team, error)
+	CreateTeam(org, name, description string) (*sdk.Team, error)
+	ListTeamMembers(org, slug string) ([]*sdk.User, error)
+	AddTeamMember(org, slug, login string) error
+	RemoveTeamMember(org, slug, login string) error
+	AddTeamRepo(org, slug, repo, permission string) error
+	RemoveTeamRepo(org, slug, repo string) error
 }
 
 type geClient interface {
 	GetDirectoryTree(org, repo, sha string, recursive int32) (gesdk.Tree, error)
 	GetPathContent(org, repo, path, ref string) (gesdk.Content, error)
+	PatchFile(owner, repo, path, branch, content, sha, message string) error
 }
 
 func newRobot(cli iClient, gecli geClient, pool *ants.Pool, o OMService, cfg *botConfig) *robot {
-	return &robot{cli: cli, gecli: gecli, pool: pool, om: o, cfg: cfg}
+	return &robot{
+		cli:    cli,
+		gecli:  gecli,
+		pool:   pool,
+		om:     o,
+		cfg:    cfg,
+		events: make(chan *reconcileEvent, maxPendingEvents),
+
+		watchers: newWatchers(cfg),
+
+		unmapped: newUnmappedUsers(),
+		teams:    newSigTeams(),
+
+		templateBlobs: newBlobCache(),
+	}
 }
 
 type robot struct {
@@ -46,4 +84,37 @@ type robot struct {
 	gecli geClient
 	om    OMService
 	wg    sync.WaitGroup
+
+	// plan is not nil in dry-run mode. It collects the changes instead of applying them.
+	plan *plan
+
+	// store persists the states of repos. It is nil if persisting is disabled.
+	store snapshot.Store
+
+	health *healthState
+
+	// identities is the mapping of gitee id to github login which overrides the OM service.
+	identities *identityMapping
+
+	// unmapped records the owners and admins which can't be mapped to GitHub in a check.
+	unmapped *unmappedUsers
+
+	// teams caches the teams of sigs which have been synchronized.
+	teams *sigTeams
+
+	// templateBlobs caches the files of the templates in repos.
+	templateBlobs *blobCache
+
+	// watchers watches the targets one by one. It is replaced when the configuration changes.
+	watchers     []*watcher
+	watchersLock sync.RWMutex
+
+	// loadConfig returns the latest configuration. It is nil if the configuration is not reloaded.
+	loadConfig configLoader
+
+	// configVersion is the version of the configuration being used.
+	configVersion string
+
+	// events receives the repos and sigs affected by the push events of community repo.
+	events chan *reconcileEvent
 }
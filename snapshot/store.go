@@ -0,0 +1,124 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/models"
+)
+
+// Snapshot is the persisted state of a repo.
+type Snapshot struct {
+	Org     string           `json:"org"`
+	Repo    string           `json:"repo"`
+	State   models.RepoState `json:"state"`
+	SavedAt time.Time        `json:"saved_at"`
+}
+
+// Store saves the states of repos, so that they can be restored after restart.
+type Store interface {
+	Save(s *Snapshot) error
+	Delete(org, repo string) error
+	LoadAll(org string) ([]Snapshot, error)
+}
+
+// NewFileStore returns a store which saves each repo as a json file
+// at <dir>/<org>/<repo>.json
+func NewFileStore(dir string) (Store, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("missing the directory of snapshot")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &fileStore{dir: dir}, nil
+}
+
+type fileStore struct {
+	dir  string
+	lock sync.Mutex
+}
+
+func (fs *fileStore) filePath(org, repo string) string {
+	return filepath.Join(fs.dir, org, repo+".json")
+}
+
+func (fs *fileStore) Save(s *Snapshot) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	p := fs.filePath(s.Org, s.Repo)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first to avoid leaving a broken file.
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, p)
+}
+
+func (fs *fileStore) Delete(org, repo string) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	err := os.Remove(fs.filePath(org, repo))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (fs *fileStore) LoadAll(org string) ([]Snapshot, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	dir := filepath.Join(fs.dir, org)
+
+	items, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	r := make([]Snapshot, 0, len(items))
+	for _, item := range items {
+		if item.IsDir() || !strings.HasSuffix(item.Name(), ".json") {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, item.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var s Snapshot
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, fmt.Errorf("decode snapshot %s, err:%s", item.Name(), err.Error())
+		}
+
+		r = append(r, s)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,49 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/opensourceways/robot-github-openeuler-repo-watcher/models"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Save(&Snapshot{
+		Org:     "src-openeuler",
+		Repo:    "test",
+		State:   models.RepoState{Available: true, Members: []string{"tom"}},
+		SavedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := s.LoadAll("src-openeuler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 1 || v[0].Repo != "test" || !v[0].State.Available || v[0].State.Members[0] != "tom" {
+		t.Errorf("unexpected snapshots: %v", v)
+	}
+
+	if err := s.Delete("src-openeuler", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err = s.LoadAll("src-openeuler"); err != nil || len(v) != 0 {
+		t.Errorf("the snapshot should be deleted, err:%v", err)
+	}
+}
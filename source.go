@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sourceGitee  = "gitee"
+	sourceGithub = "github"
+	sourceGit    = "git"
+	sourceDir    = "dir"
+)
+
+// communitySource provides the files of the branch of community repo.
+type communitySource interface {
+	// listFiles returns the path -> sha of all the files on the branch.
+	listFiles() (map[string]string, error)
+
+	// loadFile returns the content and the sha of the file.
+	loadFile(path string) ([]byte, string, error)
+
+	// updateFile updates the existing file whose sha is the one returned by loadFile.
+	updateFile(path, sha, message string, content []byte) error
+}
+
+func (bot *robot) newSource(b *repoBranch) communitySource {
+	switch b.Source {
+	case sourceGithub:
+		return &githubSource{cli: bot.cli, b: *b}
+	case sourceGit:
+		return &gitSource{dir: b.Git.Dir, url: b.Git.URL, branch: b.Branch}
+	case sourceDir:
+		return &dirSource{dir: b.Dir}
+	default:
+		return &giteeSource{cli: bot.gecli, b: *b}
+	}
+}
+
+// giteeSource reads the files by the Gitee API.
+type giteeSource struct {
+	cli geClient
+	b   repoBranch
+}
+
+func (s *giteeSource) listFiles() (map[string]string, error) {
+	trees, err := s.cli.GetDirectoryTree(s.b.Org, s.b.Repo, s.b.Branch, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]string, len(trees.Tree))
+	for i := range trees.Tree {
+		item := &trees.Tree[i]
+		r[item.Path] = item.Sha
+	}
+
+	return r, nil
+}
+
+func (s *giteeSource) loadFile(path string) ([]byte, string, error) {
+	c, err := s.cli.GetPathContent(s.b.Org, s.b.Repo, path, s.b.Branch)
+	if err != nil {
+		return nil, "", err
+	}
+
+	v, err := base64.StdEncoding.DecodeString(c.Content)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return v, c.Sha, nil
+}
+
+func (s *giteeSource) updateFile(path, sha, message string, content []byte) error {
+	return s.cli.PatchFile(
+		s.b.Org, s.b.Repo, path, s.b.Branch,
+		base64.StdEncoding.EncodeToString(content), sha, message,
+	)
+}
+
+// githubSource reads the files by the GitHub API.
+type githubSource struct {
+	cli iClient
+	b   repoBranch
+}
+
+func (s *githubSource) listFiles() (map[string]string, error) {
+	entries, err := s.cli.GetDirectoryTree(s.b.Org, s.b.Repo, s.b.Branch, true)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]string, len(entries))
+	for _, item := range entries {
+		if item.GetType() == "blob" {
+			r[item.GetPath()] = item.GetSHA()
+		}
+	}
+
+	return r, nil
+}
+
+func (s *githubSource) loadFile(path string) ([]byte, string, error) {
+	c, err := s.cli.GetPathContent(s.b.Org, s.b.Repo, path, s.b.Branch)
+	if err != nil {
+		return nil, "", err
+	}
+
+	v, err := c.GetContent()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return []byte(v), c.GetSHA(), nil
+}
+
+func (s *githubSource) updateFile(path, sha, message string, content []byte) error {
+	return s.cli.CreateFile(s.b.Org, s.b.Repo, path, s.b.Branch, message, sha, content)
+}
+
+// gitSource reads the files from a local clone of the branch, which is fetched
+// each time the files are listed. The sha of file is the one of git blob.
+type gitSource struct {
+	dir    string
+	url    string
+	branch string
+}
+
+func (s *gitSource) ref() string {
+	return "refs/remotes/origin/" + s.branch
+}
+
+func (s *gitSource) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"--git-dir", s.dir}, args...)...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s, err:%s, %s", args[0], err.Error(), stderr.String())
+	}
+
+	return out, nil
+}
+
+// fetch clones the branch if it has not been done, or fetches the latest commit of it.
+func (s *gitSource) fetch() error {
+	if _, err := os.Stat(filepath.Join(s.dir, "HEAD")); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		if _, err := s.git("init", "--bare", "-q"); err != nil {
+			return err
+		}
+
+		if _, err := s.git("remote", "add", "origin", s.url); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.git("fetch", "-q", "--depth=1", "--no-tags", "origin", "+refs/heads/"+s.branch+":"+s.ref())
+
+	return err
+}
+
+func (s *gitSource) listFiles() (map[string]string, error) {
+	if err := s.fetch(); err != nil {
+		return nil, err
+	}
+
+	out, err := s.git("ls-tree", "-r", "-z", "--full-tree", s.ref())
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]string)
+
+	// each item is "<mode> <type> <sha>\t<path>"
+	for _, item := range strings.Split(string(out), "\x00") {
+		v := strings.SplitN(item, "\t", 2)
+		if len(v) != 2 {
+			continue
+		}
+
+		if fields := strings.Fields(v[0]); len(fields) == 3 && fields[1] == "blob" {
+			r[v[1]] = fields[2]
+		}
+	}
+
+	return r, nil
+}
+
+func (s *gitSource) loadFile(path string) ([]byte, string, error) {
+	c, err := s.git("cat-file", "blob", s.ref()+":"+path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return c, gitBlobSHA(c), nil
+}
+
+// updateFile is not supported, because the local clone is only used to read the files.
+func (s *gitSource) updateFile(path, sha, message string, content []byte) error {
+	return fmt.Errorf("can't update %s, the git source is readonly", path)
+}
+
+// dirSource reads the files from a directory on disk. The sha of file is the one
+// of git blob, so that it is the same as other sources.
+type dirSource struct {
+	dir string
+}
+
+func (s *dirSource) listFiles() (map[string]string, error) {
+	r := make(map[string]string)
+
+	err := filepath.Walk(s.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+
+		_, sha, err := s.loadFile(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+
+		r[filepath.ToSlash(rel)] = sha
+
+		return nil
+	})
+
+	return r, err
+}
+
+func (s *dirSource) loadFile(path string) ([]byte, string, error) {
+	c, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.FromSlash(path)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return c, gitBlobSHA(c), nil
+}
+
+// updateFile writes the file on disk. It fails if the file has been changed since loaded.
+func (s *dirSource) updateFile(path, sha, message string, content []byte) error {
+	if _, v, err := s.loadFile(path); err != nil {
+		return err
+	} else if v != sha {
+		return fmt.Errorf("%s has been changed", path)
+	}
+
+	return ioutil.WriteFile(filepath.Join(s.dir, filepath.FromSlash(path)), content, 0644)
+}
+
+// gitBlobSHA returns the sha of content which git computes for a blob.
+func gitBlobSHA(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
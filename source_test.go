@@ -0,0 +1,214 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	p := filepath.Join(dir, filepath.FromSlash(name))
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	work := filepath.Join(dir, "work")
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", work}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v, err:%v, %s", args, err, out)
+		}
+	}
+
+	writeTestFile(t, work, "sig/Kernel/OWNERS", "maintainers:\n- tom\n")
+	git("init", "-q", "-b", "master")
+	git("add", "-A")
+	git("commit", "-q", "-m", "init")
+
+	s := &gitSource{dir: filepath.Join(dir, "clone"), url: work, branch: "master"}
+
+	files, err := s.listFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha := files["sig/Kernel/OWNERS"]
+	if len(files) != 1 || sha != gitBlobSHA([]byte("maintainers:\n- tom\n")) {
+		t.Errorf("unexpected files: %v", files)
+	}
+
+	writeTestFile(t, work, "sig/Kernel/OWNERS", "maintainers:\n- jerry\n")
+	git("commit", "-q", "-a", "-m", "update")
+
+	if files, err = s.listFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, sha1, err := s.loadFile("sig/Kernel/OWNERS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(c) != "maintainers:\n- jerry\n" || sha1 == sha || sha1 != files["sig/Kernel/OWNERS"] {
+		t.Errorf("unexpected file: %s, sha:%s", c, sha1)
+	}
+}
+
+func TestExpectStateOfDirSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, dir, "sig/Kernel/OWNERS", "maintainers:\n- tom\n")
+	writeTestFile(t, dir, "sig/Kernel/src-openeuler/k/kernel.yaml", "name: kernel\ntype: public\n")
+	writeTestFile(t, dir, "sig/Kernel/openeuler/k/kernel.yaml", "name: kernel\ntype: public\n")
+	writeTestFile(t, dir, "sig/Kernel/src-openeuler/k/README.md", "kernel")
+
+	e := &expectState{
+		log:       logrus.NewEntry(logrus.New()),
+		src:       &dirSource{dir: dir},
+		sigOwners: make(map[string]*expectSigOwners),
+		sigInfos:  make(map[string]*expectSigInfos),
+	}
+
+	if _, err := e.init("src-openeuler", "", "sig"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := e.reposInfo.GetRepos(); len(v) != 1 || v["kernel"] == nil {
+		t.Errorf("unexpected repos: %v", v)
+	}
+
+	repos, owners, _, err := e.listAllFilesOfRepo("src-openeuler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repos) != 1 || repos["sig/Kernel/src-openeuler/k/kernel.yaml"] == "" {
+		t.Errorf("unexpected repo files: %v", repos)
+	}
+
+	if len(owners) != 1 || owners["sig/Kernel/OWNERS"] != gitBlobSHA([]byte("maintainers:\n- tom\n")) {
+		t.Errorf("unexpected owners files: %v", owners)
+	}
+}
+
+func TestPatchFactoryYamlOfDirSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, dir, "master/pckg-mgmt.yaml", "packages:\n- name: kernel\n")
+
+	project := &obsMetaProject{
+		Branch:          repoBranch{Org: "openeuler", Repo: "release-management", Branch: "master", Source: sourceDir, Dir: dir},
+		ProjectDir:      "master",
+		ProjectFileName: "pckg-mgmt.yaml",
+	}
+
+	bot := &robot{}
+	bot.patchFactoryYaml(project, "gcc", logrus.NewEntry(logrus.New()))
+
+	c, _, err := bot.newSource(&project.Branch).loadFile("master/pckg-mgmt.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var y yamlStruct
+	if err := decodeYamlFile(c, &y); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(y.Packages) != 2 || y.Packages[1].Name != "gcc" || y.Packages[1].Obs_To != "openEuler:Factory" {
+		t.Errorf("unexpected packages: %v", y.Packages)
+	}
+}
+
+func TestOBSMetaProjectDefaultSource(t *testing.T) {
+	project := &obsMetaProject{
+		Branch:          repoBranch{Org: "openeuler", Repo: "obs_meta", Branch: "master"},
+		ProjectDir:      "master",
+		ProjectFileName: "pckg-mgmt.yaml",
+	}
+	project.setDefault()
+
+	if err := project.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	bot := &robot{}
+	if _, ok := bot.newSource(&project.Branch).(*githubSource); !ok {
+		t.Errorf("unexpected source: %s", project.Branch.Source)
+	}
+}
+
+func TestExpectStateOfNestedSigDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, dir, "community/sig/Kernel/sig-info.yaml", "name: Kernel\n")
+	writeTestFile(t, dir, "community/sig/Kernel/src-openeuler/k/kernel.yaml", "name: kernel\ntype: public\n")
+	writeTestFile(t, dir, "sig/Compiler/src-openeuler/g/gcc.yaml", "name: gcc\ntype: public\n")
+
+	e := &expectState{
+		log:       logrus.NewEntry(logrus.New()),
+		src:       &dirSource{dir: dir},
+		sigOwners: make(map[string]*expectSigOwners),
+		sigInfos:  make(map[string]*expectSigInfos),
+	}
+
+	if _, err := e.init("src-openeuler", "", "community/sig"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := e.reposInfo.GetRepos(); len(v) != 1 || v["kernel"] == nil {
+		t.Errorf("unexpected repos: %v", v)
+	}
+
+	repos, _, infos, err := e.listAllFilesOfRepo("src-openeuler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repos) != 1 || repos["community/sig/Kernel/src-openeuler/k/kernel.yaml"] == "" {
+		t.Errorf("unexpected repo files: %v", repos)
+	}
+
+	if len(infos) != 1 || infos["community/sig/Kernel/sig-info.yaml"] == "" {
+		t.Errorf("unexpected sig-info files: %v", infos)
+	}
+}
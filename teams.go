@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const adminTeamSuffix = "-admins"
+
+// teamState is the members of a team which have been synchronized.
+type teamState struct {
+	slug     string
+	hash     string
+	members  map[string]bool
+	syncedAt time.Time
+}
+
+// sigTeams caches the teams synchronized in the current process, so that the team
+// of a sig is updated only once instead of once per repo of the sig.
+type sigTeams struct {
+	lock  sync.Mutex
+	teams map[string]teamState
+}
+
+func newSigTeams() *sigTeams {
+	return &sigTeams{teams: make(map[string]teamState)}
+}
+
+// teamSlug returns the slug which GitHub generates from the name of team. It is only used
+// to look up the team, and the slug returned by GitHub is used after that.
+func teamSlug(name string) string {
+	b := strings.Builder{}
+	hyphen := false
+
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' {
+			b.WriteRune(c)
+			hyphen = false
+		} else if b.Len() > 0 && !hyphen {
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+
+	return strings.TrimRight(b.String(), "-")
+}
+
+// syncSigTeams makes sure the teams of sig exist and have the expected members.
+// It returns the slug -> permission of the teams and the lower case login -> the
+// highest permission of the members of them.
+func (bot *robot) syncSigTeams(org, sig string, roles *repoRoles, log *logrus.Entry) (map[string]string, map[string]string) {
+	teams := make(map[string]string)
+	members := make(map[string]string)
+
+	grant := func(login, permission string) {
+		members[login] = higherPermission(members[login], permission)
+	}
+
+	syncOne := func(name string, ids []string, permission string) {
+		logins, unmapped := bot.mapGiteeIds(ids)
+		bot.unmapped.add(sig, unmapped...)
+
+		slug, m, err := bot.syncTeam(org, name, logins, log)
+		teams[slug] = permission
+
+		if err != nil {
+			// keep the grant of team and regard the expected members as the members
+			// of it, so that a transient error will not revoke the permissions.
+			log.WithField("sync team", fmt.Sprintf("%s:%s", org, slug)).Error(err)
+
+			for _, k := range logins {
+				grant(strings.ToLower(k), permission)
+			}
+
+			return
+		}
+
+		for k := range m {
+			grant(k, permission)
+		}
+	}
+
+	p := &bot.cfg.Permissions
+
+	syncOne(sig, roles.maintainers, p.Maintainer)
+
+	if bot.cfg.Teams.AdminTeam {
+		syncOne(sig+adminTeamSuffix, roles.sigAdmins, p.Admin)
+	}
+
+	return teams, members
+}
+
+// syncTeam creates the team if it doesn't exist and updates its members. The members
+// are synchronized again after the sync interval even if the expected ones don't change,
+// so that the changes made on GitHub are reverted. It returns the slug of the team and
+// the lower case logins of the members of it. The slug is returned even if failed.
+func (bot *robot) syncTeam(org, name string, logins []string, log *logrus.Entry) (string, map[string]bool, error) {
+	expect := make(map[string]bool, len(logins))
+	for _, v := range logins {
+		expect[strings.ToLower(v)] = true
+	}
+
+	key := org + "/" + name
+	hash := hashMembers(expect)
+
+	c := bot.teams
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	v, ok := c.teams[key]
+	if ok && v.hash == hash && time.Since(v.syncedAt) < bot.cfg.Teams.syncInterval() {
+		return v.slug, v.members, nil
+	}
+
+	slug := v.slug
+	if slug == "" {
+		slug = teamSlug(name)
+	}
+
+	t, err := bot.cli.GetTeam(org, slug)
+	if err != nil {
+		return slug, nil, err
+	}
+
+	if t == nil {
+		l := log.WithField("create team", key)
+		l.Info("start")
+
+		desc := fmt.Sprintf("the members of %s", name)
+		if t, err = bot.cli.CreateTeam(org, name, desc); err != nil {
+			return slug, nil, err
+		}
+
+		recordChange(changeTeamCreated)
+	}
+
+	slug = t.GetSlug()
+	team := org + "/" + slug
+
+	// the slug is kept even if failed, and the members will be synchronized next time.
+	c.teams[key] = teamState{slug: slug}
+
+	users, err := bot.cli.ListTeamMembers(org, slug)
+	if err != nil {
+		return slug, nil, err
+	}
+
+	members := make(map[string]bool, len(users))
+	for _, u := range users {
+		members[strings.ToLower(u.GetLogin())] = true
+	}
+
+	done := true
+
+	for k := range members {
+		if expect[k] || isReservedMember(k, "") {
+			continue
+		}
+
+		l := log.WithField("remove team member", fmt.Sprintf("%s:%s", team, k))
+		l.Info("start")
+
+		if err := bot.cli.RemoveTeamMember(org, slug, k); err != nil {
+			l.Error(err)
+			done = false
+		} else {
+			recordChange(changeTeamMemberRemoved)
+			delete(members, k)
+		}
+	}
+
+	for k := range expect {
+		if members[k] {
+			continue
+		}
+
+		l := log.WithField("add team member", fmt.Sprintf("%s:%s", team, k))
+		l.Info("start")
+
+		if err := bot.cli.AddTeamMember(org, slug, k); err != nil {
+			l.Error(err)
+			done = false
+		} else {
+			recordChange(changeTeamMemberAdded)
+			members[k] = true
+		}
+	}
+
+	// it will be synchronized again at next time if failed.
+	if done {
+		c.teams[key] = teamState{
+			slug:     slug,
+			hash:     hash,
+			members:  members,
+			syncedAt: time.Now(),
+		}
+	}
+
+	return slug, members, nil
+}
+
+// handleTeams grants the teams of sig to the repo and revokes the teams which are
+// no longer expected. It returns the teams granted to the repo.
+func (bot *robot) handleTeams(expectRepo expectRepoInfo, local map[string]string, log *logrus.Entry) map[string]string {
+	if !bot.cfg.Teams.Enable {
+		return nil
+	}
+
+	org := expectRepo.org
+	repo := expectRepo.getNewRepoName()
+
+	r := make(map[string]string, len(expectRepo.teams))
+
+	for slug, lp := range local {
+		if _, ok := expectRepo.teams[slug]; ok {
+			continue
+		}
+
+		l := log.WithField("remove team repo", fmt.Sprintf("%s:%s", repo, slug))
+		l.Info("start")
+
+		if err := bot.cli.RemoveTeamRepo(org, slug, repo); err != nil {
+			l.Error(err)
+
+			r[slug] = lp
+		} else {
+			recordChange(changeTeamRepoRemoved)
+		}
+	}
+
+	for slug, ep := range expectRepo.teams {
+		if local[slug] == ep {
+			r[slug] = ep
+			continue
+		}
+
+		l := log.WithField("add team repo", fmt.Sprintf("%s:%s %s", repo, slug, ep))
+		l.Info("start")
+
+		if err := bot.cli.AddTeamRepo(org, slug, repo, ep); err != nil {
+			l.Error(err)
+
+			if lp, ok := local[slug]; ok {
+				r[slug] = lp
+			}
+		} else {
+			recordChange(changeTeamRepoUpdated)
+
+			r[slug] = ep
+		}
+	}
+
+	return r
+}
+
+func hashMembers(members map[string]bool) string {
+	v := make([]string, 0, len(members))
+	for k := range members {
+		v = append(v, k)
+	}
+	sort.Strings(v)
+
+	h := sha256.Sum256([]byte(strings.Join(v, ",")))
+
+	return hex.EncodeToString(h[:])
+}
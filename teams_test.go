@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+
+	sdk "github.com/google/go-github/v36/github"
+	"github.com/sirupsen/logrus"
+)
+
+type teamClient struct {
+	iClient
+
+	members []string
+	added   []string
+	removed []string
+	lists   int
+}
+
+func (c *teamClient) GetTeam(org, slug string) (*sdk.Team, error) {
+	return &sdk.Team{Slug: sdk.String(slug)}, nil
+}
+
+func (c *teamClient) ListTeamMembers(org, slug string) ([]*sdk.User, error) {
+	c.lists++
+
+	r := make([]*sdk.User, 0, len(c.members))
+	for i := range c.members {
+		r = append(r, &sdk.User{Login: sdk.String(c.members[i])})
+	}
+
+	return r, nil
+}
+
+func (c *teamClient) AddTeamMember(org, slug, login string) error {
+	c.added = append(c.added, login)
+	return nil
+}
+
+func (c *teamClient) RemoveTeamMember(org, slug, login string) error {
+	c.removed = append(c.removed, login)
+	return nil
+}
+
+func TestSyncTeam(t *testing.T) {
+	cli := &teamClient{members: []string{"Tom", "tuffy", "openeuler-bot"}}
+	bot := robot{
+		cli:   cli,
+		cfg:   &botConfig{Teams: teamConfig{SyncInterval: 60}},
+		teams: newSigTeams(),
+	}
+	log := logrus.NewEntry(logrus.New())
+
+	slug, members, err := bot.syncTeam("openeuler", "sig-Kernel", []string{"tom", "Jerry"}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slug != "sig-kernel" {
+		t.Errorf("unexpected slug: %s", slug)
+	}
+
+	if len(cli.added) != 1 || cli.added[0] != "jerry" {
+		t.Errorf("unexpected added members: %v", cli.added)
+	}
+
+	if len(cli.removed) != 1 || cli.removed[0] != "tuffy" {
+		t.Errorf("unexpected removed members: %v", cli.removed)
+	}
+
+	if !members["tom"] || !members["jerry"] || members["tuffy"] {
+		t.Errorf("unexpected members: %v", members)
+	}
+
+	// the team is synchronized already.
+	if _, _, err := bot.syncTeam("openeuler", "sig-Kernel", []string{"Jerry", "tom"}, log); err != nil {
+		t.Fatal(err)
+	}
+
+	if cli.lists != 1 {
+		t.Errorf("the team should not be listed again, listed %d times", cli.lists)
+	}
+}
+
+func TestTeamSlug(t *testing.T) {
+	cases := map[string]string{
+		"sig-Kernel":        "sig-kernel",
+		"sig Kernel.admins": "sig-kernel-admins",
+		"sig_test--":        "sig_test",
+	}
+
+	for name, slug := range cases {
+		if v := teamSlug(name); v != slug {
+			t.Errorf("unexpected slug of %s: %s", name, v)
+		}
+	}
+}
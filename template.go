@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+)
+
+// templateSuffix is the suffix of the template files which will be rendered.
+const templateSuffix = ".tmpl"
+
+// autoInitFile is the file created by GitHub when the repo is created, which is
+// always overwritten by the one of template.
+const autoInitFile = "README.md"
+
+type templateFile struct {
+	path    string
+	content []byte
+}
+
+// templateData is the data used to render the template files.
+type templateData struct {
+	Org         string
+	Name        string
+	Description string
+	Sig         string
+}
+
+// applyTemplate writes the files of template to the default branch of the newly created repo.
+// The files with suffix of ".tmpl" are rendered with the information of repo, and the suffix
+// is trimmed. A CODEOWNERS is generated if it is enabled and not included by the template.
+func (bot *robot) applyTemplate(expectRepo expectRepoInfo, defaultBranch string, log *logrus.Entry) {
+	org := expectRepo.org
+	repo := expectRepo.expectRepoState
+
+	t := bot.cfg.Templates.get(org, expectRepo.sig)
+	if t == nil {
+		return
+	}
+
+	log = log.WithField("apply template", repo.Name)
+
+	files, err := bot.loadTemplate(t)
+	if err != nil {
+		log.Errorf("load template, err:%s", err.Error())
+		return
+	}
+
+	data := templateData{
+		Org:         org,
+		Name:        repo.Name,
+		Description: repo.Description,
+		Sig:         expectRepo.sig,
+	}
+
+	hasCodeOwners := false
+	for i := range files {
+		f := &files[i]
+
+		if strings.HasSuffix(f.path, templateSuffix) {
+			if f.content, err = renderTemplate(f.path, f.content, &data); err != nil {
+				log.Errorf("render %s, err:%s", f.path, err.Error())
+				continue
+			}
+
+			f.path = strings.TrimSuffix(f.path, templateSuffix)
+		}
+
+		if f.path == codeOwnersFile {
+			hasCodeOwners = true
+		}
+
+		bot.writeFile(org, repo.Name, defaultBranch, f, t.Overwrite, log)
+	}
+
+	if t.CodeOwners && !hasCodeOwners {
+		if c := genCodeOwners(&expectRepo); len(c) > 0 {
+			bot.writeFile(org, repo.Name, defaultBranch, &templateFile{codeOwnersFile, c}, t.Overwrite, log)
+		}
+	}
+}
+
+// writeFile creates the file. The existing one is overwritten only if overwrite is true
+// or it is created by GitHub.
+func (bot *robot) writeFile(org, repo, branch string, f *templateFile, overwrite bool, log *logrus.Entry) {
+	sha := ""
+
+	v, err := bot.cli.GetPathContent(org, repo, f.path, branch)
+	if err == nil {
+		if !overwrite && f.path != autoInitFile {
+			log.Infof("%s exists, skip it", f.path)
+			return
+		}
+
+		sha = v.GetSHA()
+	} else if !isNotFoundError(err) {
+		log.Errorf("get %s, err:%s", f.path, err.Error())
+		return
+	}
+
+	msg := fmt.Sprintf("add %s", f.path)
+	if err := bot.cli.CreateFile(org, repo, f.path, branch, msg, sha, f.content); err != nil {
+		log.Errorf("write %s, err:%s", f.path, err.Error())
+	}
+}
+
+func renderTemplate(name string, content []byte, data *templateData) ([]byte, error) {
+	t, err := template.New(name).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	b := new(bytes.Buffer)
+	if err := t.Execute(b, data); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func (bot *robot) loadTemplate(t *repoTemplate) ([]templateFile, error) {
+	if t.Dir != "" {
+		return loadTemplateFromDir(t.Dir)
+	}
+
+	return bot.loadTemplateFromRepo(t)
+}
+
+// loadTemplateFromRepo lists the files of template and loads the ones which are not
+// in the cache, so that only the changed files are loaded for each new repo.
+func (bot *robot) loadTemplateFromRepo(t *repoTemplate) ([]templateFile, error) {
+	org, repo := t.orgRepo()
+
+	trees, err := bot.cli.GetDirectoryTree(org, repo, t.Branch, true)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]templateFile, 0, len(trees))
+	for _, item := range trees {
+		if item.GetType() != "blob" {
+			continue
+		}
+
+		sha := item.GetSHA()
+		if c, ok := bot.templateBlobs.get(sha); ok {
+			r = append(r, templateFile{path: item.GetPath(), content: c})
+			continue
+		}
+
+		f, err := bot.cli.GetPathContent(org, repo, item.GetPath(), t.Branch)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := f.GetContent()
+		if err != nil {
+			return nil, err
+		}
+
+		bot.templateBlobs.set(sha, []byte(c))
+		r = append(r, templateFile{path: item.GetPath(), content: []byte(c)})
+	}
+
+	return r, nil
+}
+
+// blobCache is the sha -> content of the files of templates.
+type blobCache struct {
+	lock  sync.RWMutex
+	blobs map[string][]byte
+}
+
+func newBlobCache() *blobCache {
+	return &blobCache{blobs: make(map[string][]byte)}
+}
+
+func (c *blobCache) get(sha string) ([]byte, bool) {
+	if c == nil || sha == "" {
+		return nil, false
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	v, ok := c.blobs[sha]
+
+	return v, ok
+}
+
+func (c *blobCache) set(sha string, content []byte) {
+	if c == nil || sha == "" {
+		return
+	}
+
+	c.lock.Lock()
+	c.blobs[sha] = content
+	c.lock.Unlock()
+}
+
+func loadTemplateFromDir(dir string) ([]templateFile, error) {
+	r := make([]templateFile, 0)
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		c, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		r = append(r, templateFile{path: filepath.ToSlash(rel), content: c})
+
+		return nil
+	})
+
+	return r, err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sdk "github.com/google/go-github/v36/github"
+)
+
+func TestLoadTemplateFromDir(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"LICENSE":                          "license",
+		"README.md.tmpl":                   "# {{.Name}}\n{{.Description}} of {{.Sig}}",
+		".github/ISSUE_TEMPLATE/bug.md":    "bug",
+		".git/config":                      "ignored",
+		".github/PULL_REQUEST_TEMPLATE.md": "pr",
+	}
+	for k, v := range files {
+		p := filepath.Join(dir, filepath.FromSlash(k))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(v), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := loadTemplateFromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 4 {
+		t.Fatalf("unexpected files: %v", items)
+	}
+
+	for _, item := range items {
+		if item.path != "README.md.tmpl" {
+			continue
+		}
+
+		c, err := renderTemplate(item.path, item.content, &templateData{
+			Name: "test", Description: "a test repo", Sig: "sig-test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(c) != "# test\na test repo of sig-test" {
+			t.Errorf("unexpected README: %s", c)
+		}
+	}
+}
+
+type templateClient struct {
+	iClient
+
+	loaded int
+}
+
+func (c *templateClient) GetDirectoryTree(org, repo, branch string, recursive bool) ([]*sdk.TreeEntry, error) {
+	return []*sdk.TreeEntry{
+		{Path: sdk.String("README.md.tmpl"), Type: sdk.String("blob"), SHA: sdk.String("1")},
+		{Path: sdk.String(".github"), Type: sdk.String("tree"), SHA: sdk.String("2")},
+	}, nil
+}
+
+func (c *templateClient) GetPathContent(org, repo, path, branch string) (*sdk.RepositoryContent, error) {
+	c.loaded++
+
+	return &sdk.RepositoryContent{Content: sdk.String("# {{.Name}}")}, nil
+}
+
+func TestLoadTemplateFromRepo(t *testing.T) {
+	cli := new(templateClient)
+	bot := robot{cli: cli, templateBlobs: newBlobCache()}
+	tmpl := &repoTemplate{Repo: "openeuler/template", Branch: "master"}
+
+	for i := 0; i < 2; i++ {
+		items, err := bot.loadTemplateFromRepo(tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(items) != 1 || string(items[0].content) != "# {{.Name}}" {
+			t.Errorf("unexpected files: %v", items)
+		}
+	}
+
+	if cli.loaded != 1 {
+		t.Errorf("the cached file should not be loaded again, loaded %d times", cli.loaded)
+	}
+}
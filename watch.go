@@ -6,12 +6,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/opensourceways/community-robot-lib/utils"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/opensourceways/robot-github-openeuler-repo-watcher/community"
 	"github.com/opensourceways/robot-github-openeuler-repo-watcher/models"
@@ -22,84 +25,282 @@ type expectRepoInfo struct {
 	expectOwners    []string
 	expectAdmins    []string
 	org             string
+	sig             string
+
+	// expectMembers is the github login -> permission of all the expected collaborators.
+	expectMembers map[string]string
+
+	// teams is the slug -> permission of the teams of sig which are granted to the repo.
+	teams map[string]string
+
+	// teamMembers is the lower case login -> the highest permission granted by the teams.
+	teamMembers map[string]string
+
+	// obs is the obs meta project which the new repos are added to. It is nil if disabled.
+	obs *obsMetaProject
 }
 
 func (e *expectRepoInfo) getNewRepoName() string {
 	return e.expectRepoState.Name
 }
 
+// isGrantedByTeam returns true if the member has been granted the permission by the teams.
+func (e *expectRepoInfo) isGrantedByTeam(login, permission string) bool {
+	p, ok := e.teamMembers[login]
+
+	return ok && permissionLevels[p] >= permissionLevels[permission]
+}
+
+// expectedPermissions returns the permissions of all the expected collaborators.
+func (e *expectRepoInfo) expectedPermissions() map[string]string {
+	r := make(map[string]string, len(e.expectMembers))
+
+	for k, v := range e.expectMembers {
+		r[strings.ToLower(k)] = v
+	}
+
+	return r
+}
+
+// watcher watches the repos declared by the community repo of a target.
+type watcher struct {
+	target *watchTarget
+	local  *localState
+	expect *expectState
+
+	// orphanReportAt is the time when the orphan repos were reported last time.
+	orphanReportAt time.Time
+}
+
+func newWatchers(cfg *botConfig) []*watcher {
+	r := make([]*watcher, len(cfg.Targets))
+	for i := range cfg.Targets {
+		r[i] = &watcher{target: &cfg.Targets[i]}
+	}
+
+	return r
+}
+
 func (bot *robot) run(ctx context.Context, log *logrus.Entry) error {
-	w := &bot.cfg.WatchingFiles
-	expect := &expectState{
-		w:         w.repoBranch,
+	for _, w := range bot.watchers {
+		if err := bot.prepare(ctx, w, 0, log); err != nil {
+			return err
+		}
+	}
+
+	bot.health.setReady()
+
+	bot.watch(ctx, log)
+	return nil
+}
+
+// prepare loads the expect and local states of the target. attempts is the max times
+// of trying, and it retries until it succeeds if attempts is 0.
+func (bot *robot) prepare(ctx context.Context, w *watcher, attempts int, log *logrus.Entry) error {
+	t := w.target
+	log = log.WithField("org", t.GithubOrg)
+
+	w.expect = &expectState{
+		w:         t.repoBranch,
 		log:       log,
 		cli:       bot.cli,
-		gecli:     bot.gecli,
+		src:       bot.newSource(&t.repoBranch),
 		sigOwners: make(map[string]*expectSigOwners),
 		sigInfos:  make(map[string]*expectSigInfos),
 	}
 
-	org, err := expect.init(w.RepoOrg, w.SigFilePath, w.SigDir)
-	if err != nil {
-		return err
-	}
+	prepare := func() (err error) {
+		if _, err = w.expect.init(t.RepoOrg, t.SigFilePath, t.SigDir); err != nil {
+			return err
+		}
 
-	local, err := bot.loadALLRepos(org)
-	if err != nil {
-		log.Errorf("Load repos of org(%s) failed, err:%s", org, err.Error())
+		if w.local, err = bot.loadLocalState(t.GithubOrg, log); err != nil {
+			log.Errorf("Load repos of org(%s) failed, err:%s", t.GithubOrg, err.Error())
+		}
 		return err
 	}
 
-	err = bot.loadAllPckgMgmtFile()
-	if err != nil {
-		log.Errorf("load all pckg-mgmt.yaml failed, err:%s", err.Error())
+	// retry until it succeeds, so that the readiness probe can reflect the failure.
+	// It doesn't retry in dry-run mode which checks only once.
+	for i := 1; ; i++ {
+		err := prepare()
+		if err == nil {
+			break
+		}
+
+		log.Errorf("prepare watching, err:%s", err.Error())
+
+		if bot.plan != nil || i == attempts || !sleepWithContext(ctx, time.Minute) {
+			return err
+		}
 	}
 
-	bot.watch(ctx, org, local, expect)
 	return nil
 }
 
-func (bot *robot) watch(ctx context.Context, org string, local *localState, expect *expectState) {
-	if interval := bot.cfg.Interval; interval <= 0 {
-		for {
-			if isCancelled(ctx) {
-				break
-			}
+func (bot *robot) getWatchers() []*watcher {
+	bot.watchersLock.RLock()
+	defer bot.watchersLock.RUnlock()
+
+	return bot.watchers
+}
+
+func (bot *robot) setWatchers(ws []*watcher) {
+	bot.watchersLock.Lock()
+	bot.watchers = ws
+	bot.watchersLock.Unlock()
+}
+
+func (bot *robot) watch(ctx context.Context, log *logrus.Entry) {
+	if bot.plan != nil {
+		bot.checkOnce(ctx, log)
+		bot.wg.Wait()
+
+		return
+	}
+
+	for !isCancelled(ctx) {
+		// apply the changes of configuration between the checks.
+		bot.reloadConfig(ctx, log)
+
+		interval := bot.cfg.Interval
+		if interval <= 0 {
+			// the full check will cover the pending events.
+			bot.drainEvents()
+
+			bot.checkOnce(ctx, log)
 
-			bot.checkOnce(ctx, org, local, expect)
+			continue
 		}
-	} else {
+
 		t := time.Duration(interval) * time.Minute
+		s := time.Now()
 
-		for {
-			if isCancelled(ctx) {
-				break
-			}
+		bot.checkOnce(ctx, log)
 
-			s := time.Now()
+		e := time.Now()
+		if v := e.Sub(s); v < t {
+			bot.waitForEvents(ctx, t-v, func(ev *reconcileEvent) {
+				bot.checkAffected(ctx, ev)
+			})
+		}
+	}
 
-			bot.checkOnce(ctx, org, local, expect)
+	bot.wg.Wait()
+}
+
+// waitForEvents handles the push events until d elapses or ctx is cancelled.
+func (bot *robot) waitForEvents(ctx context.Context, d time.Duration, handle func(*reconcileEvent)) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			return
+		case ev := <-bot.events:
+			evs := []*reconcileEvent{ev}
+
+			// merge the events which arrived meanwhile.
+			for more := true; more; {
+				select {
+				case v := <-bot.events:
+					evs = mergeEvent(evs, v)
+				default:
+					more = false
+				}
+			}
 
-			e := time.Now()
-			if v := e.Sub(s); v < t {
-				time.Sleep(t - v)
+			for _, v := range evs {
+				handle(v)
 			}
 		}
 	}
+}
+
+func (bot *robot) drainEvents() {
+	for {
+		select {
+		case <-bot.events:
+		default:
+			return
+		}
+	}
+}
 
+func (bot *robot) checkOnce(ctx context.Context, log *logrus.Entry) {
+	start := time.Now()
+
+	log.Info("new check")
+
+	if err := bot.identities.refresh(); err != nil {
+		log.Errorf("refresh identity mapping, err:%s", err.Error())
+	}
+
+	bot.unmapped.reset()
+
+	done := true
+	for _, w := range bot.watchers {
+		if isCancelled(ctx) {
+			break
+		}
+
+		bot.revalidateStale(w.local, w.expect.log)
+
+		if err := bot.check(ctx, w, nil); err != nil {
+			w.expect.log.Errorf("check, err:%s", err.Error())
+			done = false
+		}
+	}
+
+	bot.unmapped.report(bot.cfg.UnmappedReportFile, log)
+
+	// wait for the tasks, so that the duration includes the reconciliation of repos.
 	bot.wg.Wait()
+
+	checkDuration.Observe(time.Since(start).Seconds())
+	lastCheckTimestamp.SetToCurrentTime()
+
+	// the watcher is not regarded as alive if it fails to check.
+	if done {
+		bot.health.checkDone()
+	}
+
+	if isCancelled(ctx) {
+		return
+	}
+
+	for _, w := range bot.watchers {
+		bot.reportOrphanRepos(w, w.expect.log)
+	}
+}
+
+// checkAffected only checks the repos which are affected by the push event.
+func (bot *robot) checkAffected(ctx context.Context, ev *reconcileEvent) {
+	w := ev.target
+	w.expect.log.Infof("check affected repos:%v, sigs:%v", ev.repos.List(), ev.sigs.List())
+
+	if err := bot.check(ctx, w, ev.has); err != nil {
+		w.expect.log.Errorf("check affected repos, err:%s", err.Error())
+	}
 }
 
-func (bot *robot) checkOnce(ctx context.Context, org string, local *localState, expect *expectState) {
-	f := func(repo *community.Repository, owners []string, admins []string, sigLabel string, log *logrus.Entry) {
+func (bot *robot) check(ctx context.Context, w *watcher, filter func(repo, sig string) bool) error {
+	org := w.target.GithubOrg
+	local := w.local
+	expect := w.expect
+
+	f := func(repo *community.Repository, roles *repoRoles, sigLabel string, log *logrus.Entry) {
 		if repo == nil {
 			return
 		}
 
 		e := expectRepoInfo{
 			org:             org,
-			expectOwners:    bot.transformGiteeId(owners),
-			expectAdmins:    bot.transformGiteeId(admins),
+			sig:             sigLabel,
+			obs:             w.target.obsProject(),
 			expectRepoState: repo,
 		}
 
@@ -107,6 +308,16 @@ func (bot *robot) checkOnce(ctx context.Context, org string, local *localState,
 			return
 		}
 
+		if sigLabel == sigRecycle && !bot.cfg.Recycle.Enable {
+			return
+		}
+
+		e.expectOwners, e.expectAdmins, e.expectMembers = bot.expectMembers(repo, roles)
+
+		if bot.cfg.Teams.Enable && sigLabel != sigRecycle {
+			e.teams, e.teamMembers = bot.syncSigTeams(org, sigLabel, roles, log)
+		}
+
 		err := bot.execTask(
 			local.getOrNewRepo(repo.Name),
 			e,
@@ -122,9 +333,66 @@ func (bot *robot) checkOnce(ctx context.Context, org string, local *localState,
 		return isCancelled(ctx)
 	}
 
-	expect.log.Info("new check")
+	clearLocal := func(isExpectedRepo, isRenamedRepo func(string) bool) {
+		for _, v := range local.clear(isExpectedRepo, isRenamedRepo) {
+			bot.handleOrphanRepo(org, v, expect.log)
+		}
+	}
+
+	// collect the repos first, so that the gitee ids of them can be resolved in
+	// one pass before building the expected states.
+	var pending []pendingRepo
+	collect := func(repo *community.Repository, roles *repoRoles, sigLabel string, log *logrus.Entry) {
+		if repo != nil {
+			pending = append(pending, pendingRepo{repo: repo, roles: roles, sig: sigLabel, log: log})
+		}
+	}
+
+	if err := expect.check(w.target.RepoOrg, isStopped, clearLocal, filter, collect); err != nil {
+		return err
+	}
+
+	bot.prefetchGiteeIds(giteeIdsOf(pending))
+
+	for i := range pending {
+		if isStopped() {
+			break
+		}
+
+		item := &pending[i]
+		f(item.repo, item.roles, item.sig, item.log)
+	}
 
-	expect.check(org, isStopped, local.clear, f)
+	return nil
+}
+
+type pendingRepo struct {
+	repo  *community.Repository
+	roles *repoRoles
+	sig   string
+	log   *logrus.Entry
+}
+
+// giteeIdsOf returns the unique gitee ids of all the members of the repos.
+func giteeIdsOf(pending []pendingRepo) []string {
+	ids := sets.NewString()
+
+	for i := range pending {
+		roles := pending[i].roles
+		ids.Insert(roles.maintainers...)
+		ids.Insert(roles.committers...)
+		ids.Insert(roles.contributors...)
+		ids.Insert(roles.admins...)
+		ids.Insert(roles.sigAdmins...)
+
+		repo := pending[i].repo
+		ids.Insert(repo.Viewers...)
+		ids.Insert(repo.Reporters...)
+		ids.Insert(repo.Developers...)
+		ids.Insert(repo.Managers...)
+	}
+
+	return ids.UnsortedList()
 }
 
 // check if the repo should be handle by github robot
@@ -145,35 +413,112 @@ func CanProcess(e expectRepoInfo) bool {
 }
 
 func (bot *robot) execTask(localRepo *models.Repo, expectRepo expectRepoInfo, sigLabel string, log *logrus.Entry) error {
-	f := func(before models.RepoState) models.RepoState {
+	reconcile := func(before models.RepoState) models.RepoState {
+		if expectRepo.sig == sigRecycle {
+			return bot.recycleRepo(expectRepo, before, log)
+		}
+
 		if !before.Available {
-			return bot.createRepo(expectRepo, log, bot.patchFactoryYaml)
+			before = bot.findRepoInAttic(expectRepo.getNewRepoName(), log)
 		}
 
-		ms, as := bot.handleMember(expectRepo, before.Members, before.Admins, &before.Owner, log)
+		if !before.Available {
+			return bot.createRepo(expectRepo, log, func(repo string, log *logrus.Entry) {
+				bot.patchFactoryYaml(expectRepo.obs, repo, log)
+			})
+		}
+
+		// only the repo recycled by the watcher is revived.
+		if bot.cfg.Recycle.Enable && before.Property.IsRecycled() {
+			if !bot.reviveRepo(expectRepo.org, expectRepo.getNewRepoName(), &before.Property, log) {
+				return before
+			}
+		}
+
+		ms, ps := bot.handleMember(expectRepo, before.Members, before.Permissions, &before.Owner, log)
+
+		property := before.Property
+		checkedAt := before.ProtectionCheckedAt
+		interval := bot.cfg.BranchProtection.refreshInterval()
+		if checkedAt.IsZero() {
+			// spread the refreshes of repos over the interval, so that the rules
+			// of all the repos are not fetched at once.
+			checkedAt = time.Now().Add(-time.Duration(rand.Int63n(int64(interval))))
+		}
+
+		refresh := time.Since(checkedAt) >= interval
+
+		bs, ub, refreshed := bot.handleBranch(
+			expectRepo, before.Branches, before.UndeclaredBranches, property.Settings.DefaultBranch, refresh, log,
+		)
+		if refresh && refreshed {
+			checkedAt = time.Now()
+		}
+		bs = bot.handleDefaultBranch(expectRepo, &property, bs, log)
 
 		return models.RepoState{
-			Available: true,
-			Branches:  bot.handleBranch(expectRepo, before.Branches, log),
-			Members:   ms,
-			Admins:    as,
-			Property:  bot.updateRepo(expectRepo, before.Property, log),
-			Owner:     before.Owner,
+			Available:           true,
+			Branches:            bs,
+			Members:             ms,
+			Permissions:         ps,
+			Property:            bot.updateRepo(expectRepo, property, log),
+			Owner:               before.Owner,
+			UndeclaredBranches:  ub,
+			ProtectionCheckedAt: checkedAt,
+			Teams:               bot.handleTeams(expectRepo, before.Teams, log),
+			CodeOwnersHash: bot.handleCodeOwners(
+				expectRepo, property.Settings.DefaultBranch, before.CodeOwnersHash, log,
+			),
+		}
+	}
+
+	f := func(before models.RepoState) models.RepoState {
+		defer reposChecked.Inc()
+
+		s := reconcile(before)
+		if s.Available {
+			bot.saveSnapshot(expectRepo.org, expectRepo.getNewRepoName(), s, log)
 		}
+
+		return s
 	}
 
+	return bot.submit(func() {
+		localRepo.Update(f)
+	})
+}
+
+// submit submits the task to the pool and tracks it, so that the watcher can wait for it.
+func (bot *robot) submit(task func()) error {
 	bot.wg.Add(1)
+	pendingTasks.Inc()
+
 	err := bot.pool.Submit(func() {
 		defer bot.wg.Done()
 
-		localRepo.Update(f)
+		pendingTasks.Dec()
+		task()
 	})
 	if err != nil {
+		pendingTasks.Dec()
 		bot.wg.Done()
 	}
 	return err
 }
 
+// sleepWithContext returns false if the ctx is cancelled before d elapses.
+func sleepWithContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
 func isCancelled(ctx context.Context) bool {
 	select {
 	case <-ctx.Done():
@@ -209,23 +554,82 @@ type Identities struct {
 }
 
 func (bot *robot) transformGiteeId(giteeIds []string) []string {
-	var githubId []string
+	githubId, _ := bot.mapGiteeIds(giteeIds)
+
+	return githubId
+}
+
+// prefetchGiteeIds looks up the gitee ids which are not in the identity mapping file
+// concurrently, so that the lookups when building the expected states hit the cache
+// of OM service. The errors are ignored here and will be reported by mapGiteeIds.
+func (bot *robot) prefetchGiteeIds(giteeIds []string) {
+	if bot.cfg.IdentityMappingOnly {
+		return
+	}
+
+	ids := make(chan string)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < bot.cfg.ConcurrentSize; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for id := range ids {
+				_, _ = bot.om.GetUserInfo(id)
+			}
+		}()
+	}
+
+	for _, id := range giteeIds {
+		if _, ok := bot.identities.get(id); !ok {
+			ids <- id
+		}
+	}
+
+	close(ids)
+	wg.Wait()
+}
+
+// mapGiteeIds maps the gitee ids to github logins by the identity mapping file first
+// and then the OM service. It also returns the ids which can't be mapped.
+func (bot *robot) mapGiteeIds(giteeIds []string) (githubId []string, unmapped []string) {
 	for _, id := range giteeIds {
+		if v, ok := bot.identities.get(id); ok {
+			githubId = append(githubId, v)
+			continue
+		}
+
+		if bot.cfg.IdentityMappingOnly {
+			unmapped = append(unmapped, id)
+			continue
+		}
+
 		userInfo, err := bot.om.GetUserInfo(id)
 		if err != nil {
+			omLookupFailures.Inc()
 			logrus.Errorf("get user info of [%s] when transformGiteeId error: %s", id, err.Error())
+
+			unmapped = append(unmapped, id)
 			continue
 		}
 
+		found := false
 		for _, v := range userInfo {
 			if v.Identity == "github" {
 				githubId = append(githubId, v.LoginName)
+				found = true
 				break
 			}
 		}
+
+		if !found {
+			unmapped = append(unmapped, id)
+		}
 	}
 
-	return githubId
+	return
 }
 
 type OMService interface {
@@ -235,6 +639,10 @@ type OMService interface {
 
 type omService struct {
 	cfg OMApi
+
+	lock        sync.Mutex
+	token       string
+	tokenExpiry time.Time
 }
 
 func NewOMService(c OMApi) *omService {
@@ -243,7 +651,33 @@ func NewOMService(c OMApi) *omService {
 	}
 }
 
+// GetToken returns the cached token if it is not expired, otherwise fetches a new one.
 func (o *omService) GetToken() (string, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.token != "" && time.Now().Before(o.tokenExpiry) {
+		return o.token, nil
+	}
+
+	t, err := o.fetchToken()
+	if err != nil {
+		return "", err
+	}
+
+	o.token = t
+	o.tokenExpiry = time.Now().Add(time.Duration(o.cfg.TokenTTL) * time.Minute)
+
+	return t, nil
+}
+
+func (o *omService) resetToken() {
+	o.lock.Lock()
+	o.token = ""
+	o.lock.Unlock()
+}
+
+func (o *omService) fetchToken() (string, error) {
 	request := omTokenReq{
 		GrantType: "token",
 		AppId:     o.cfg.AppId,
@@ -295,10 +729,15 @@ func (o *omService) GetUserInfo(giteeId string) ([]Identities, error) {
 			return nil, nil
 		}
 
+		// the token may be invalid, fetch a new one next time.
+		o.resetToken()
+
 		return nil, err
 	}
 
 	if v.Code != 200 {
+		o.resetToken()
+
 		return nil, errors.New(v.Msg)
 	}
 
@@ -35,7 +35,8 @@ func TestCanProcess(t *testing.T) {
 
 func TestTransformGiteeId(t *testing.T) {
 	bot := robot{
-		om: new(omServiceTest),
+		cfg: &botConfig{},
+		om:  new(omServiceTest),
 	}
 
 	testCase := []string{"tom-gitee", "I-am-a-robot", "xxxxxxx"}
@@ -83,3 +84,21 @@ func (o *omServiceTest) GetUserInfo(giteeId string) ([]Identities, error) {
 		return nil, nil
 	}
 }
+
+func TestMapGiteeIds(t *testing.T) {
+	bot := robot{
+		cfg:        &botConfig{},
+		om:         new(omServiceTest),
+		identities: &identityMapping{m: map[string]string{"xxxxxxx": "x-github"}},
+	}
+
+	githubId, unmapped := bot.mapGiteeIds([]string{"tom-gitee", "I-am-a-robot", "xxxxxxx"})
+
+	if len(githubId) != 2 || githubId[0] != "tom-github" || githubId[1] != "x-github" {
+		t.Errorf("unexpected github ids: %v", githubId)
+	}
+
+	if len(unmapped) != 1 || unmapped[0] != "I-am-a-robot" {
+		t.Errorf("unexpected unmapped ids: %v", unmapped)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	giteeEventHeader = "X-Gitee-Event"
+	giteeTokenHeader = "X-Gitee-Token"
+	giteePushHook    = "Push Hook"
+
+	// maxPayloadSize is the max size of the body of webhook request.
+	maxPayloadSize = 10 << 20
+)
+
+// giteePushEvent includes the fields of Gitee push hook which are needed.
+type giteePushEvent struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
+	} `json:"commits"`
+}
+
+func (e *giteePushEvent) changedFiles() []string {
+	r := make([]string, 0)
+	for i := range e.Commits {
+		c := &e.Commits[i]
+
+		r = append(r, c.Added...)
+		r = append(r, c.Removed...)
+		r = append(r, c.Modified...)
+	}
+
+	return r
+}
+
+// reconcileEvent includes the repos and sigs which should be reconciled immediately.
+type reconcileEvent struct {
+	repos sets.String
+	sigs  sets.String
+
+	// target is the watcher of the community repo which is pushed.
+	target *watcher
+}
+
+func (e *reconcileEvent) isEmpty() bool {
+	return e.repos.Len() == 0 && e.sigs.Len() == 0
+}
+
+func (e *reconcileEvent) merge(e1 *reconcileEvent) {
+	e.repos.Insert(e1.repos.UnsortedList()...)
+	e.sigs.Insert(e1.sigs.UnsortedList()...)
+}
+
+// mergeEvent merges the event to the one of the same target, or appends it.
+func mergeEvent(evs []*reconcileEvent, e *reconcileEvent) []*reconcileEvent {
+	for _, v := range evs {
+		if v.target == e.target {
+			v.merge(e)
+
+			return evs
+		}
+	}
+
+	return append(evs, e)
+}
+
+func (e *reconcileEvent) has(repo, sig string) bool {
+	return e.repos.Has(repo) || e.sigs.Has(sig)
+}
+
+// newReconcileEvent parses the changed files to find out the affected repos and sigs.
+// The repo file is at <sigDir>/<sig>/<org>/<x>/<repo>.yaml, and the owners of sig are
+// at <sigDir>/<sig>/OWNERS or <sigDir>/<sig>/sig-info.yaml
+func newReconcileEvent(files []string, sigDir, org string) *reconcileEvent {
+	e := &reconcileEvent{
+		repos: sets.NewString(),
+		sigs:  sets.NewString(),
+	}
+
+	for _, f := range files {
+		if _, repo, ok := parseRepoFile(f, sigDir, org); ok {
+			e.repos.Insert(repo)
+		} else if sig, _, ok := parseSigFile(f, sigDir); ok {
+			e.sigs.Insert(sig)
+		}
+	}
+
+	return e
+}
+
+type webhookHandler struct {
+	bot    *robot
+	secret []byte
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "405 Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if t := r.Header.Get(giteeTokenHeader); subtle.ConstantTimeCompare([]byte(t), h.secret) != 1 {
+		http.Error(w, "403 Forbidden: invalid token", http.StatusForbidden)
+		return
+	}
+
+	if v := r.Header.Get(giteeEventHeader); v != giteePushHook {
+		fmt.Fprintf(w, "ignore event: %s", v)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, "500 Internal Server Error: failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	e := new(giteePushEvent)
+	if err := json.Unmarshal(payload, e); err != nil {
+		http.Error(w, "400 Bad Request: invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	h.handlePushEvent(e)
+
+	fmt.Fprint(w, "Event received. Have a nice day.")
+}
+
+func (h *webhookHandler) handlePushEvent(e *giteePushEvent) {
+	for _, w := range h.bot.getWatchers() {
+		t := w.target
+
+		if e.Repository.FullName != t.Org+"/"+t.Repo || e.Ref != "refs/heads/"+t.Branch {
+			continue
+		}
+
+		v := newReconcileEvent(e.changedFiles(), t.SigDir, t.RepoOrg)
+		if v.isEmpty() {
+			continue
+		}
+
+		v.target = w
+
+		select {
+		case h.bot.events <- v:
+			logrus.Infof(
+				"receive push event of org:%s, repos:%v, sigs:%v",
+				t.GithubOrg, v.repos.List(), v.sigs.List(),
+			)
+		default:
+			// the polling will cover it.
+			logrus.Warning("too many pending push events, drop it")
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import "testing"
+
+func TestNewReconcileEvent(t *testing.T) {
+	files := []string{
+		"sig/Kernel/src-openeuler/k/kernel.yaml",
+		"sig/Kernel/openeuler/k/kernel-doc.yaml",
+		"sig/Compiler/OWNERS",
+		"sig/Desktop/sig-info.yaml",
+		"sig/Desktop/README.md",
+		"docs/src-openeuler/x/y/z.yaml",
+	}
+
+	e := newReconcileEvent(files, "sig", "src-openeuler")
+
+	if e.repos.Len() != 1 || !e.repos.Has("kernel") {
+		t.Errorf("unexpected repos: %v", e.repos.List())
+	}
+
+	if e.sigs.Len() != 2 || !e.sigs.Has("Compiler") || !e.sigs.Has("Desktop") {
+		t.Errorf("unexpected sigs: %v", e.sigs.List())
+	}
+
+	if !e.has("other", "Compiler") || e.has("other", "Kernel") {
+		t.Error("unexpected result of has")
+	}
+
+	files = []string{
+		"community/sig/Kernel/src-openeuler/k/kernel.yaml",
+		"community/sig/Compiler/OWNERS",
+		"sig/Desktop/sig-info.yaml",
+	}
+
+	e = newReconcileEvent(files, "community/sig", "src-openeuler")
+
+	if e.repos.Len() != 1 || !e.repos.Has("kernel") || e.sigs.Len() != 1 || !e.sigs.Has("Compiler") {
+		t.Errorf("unexpected event of nested sig dir: %v, %v", e.repos.List(), e.sigs.List())
+	}
+}
+
+func TestHandlePushEvent(t *testing.T) {
+	cfg := &botConfig{
+		Targets: []watchTarget{
+			{watchingFiles: watchingFiles{
+				repoBranch: repoBranch{Org: "openeuler", Repo: "community", Branch: "master"},
+				RepoOrg:    "src-openeuler",
+				SigDir:     "sig",
+			}},
+			{watchingFiles: watchingFiles{
+				repoBranch: repoBranch{Org: "openeuler", Repo: "community", Branch: "master"},
+				RepoOrg:    "openeuler",
+				SigDir:     "sig",
+			}},
+			{watchingFiles: watchingFiles{
+				repoBranch: repoBranch{Org: "mindspore", Repo: "community", Branch: "master"},
+				RepoOrg:    "mindspore",
+				SigDir:     "sig",
+			}},
+		},
+	}
+
+	bot := &robot{
+		cfg:      cfg,
+		events:   make(chan *reconcileEvent, maxPendingEvents),
+		watchers: newWatchers(cfg),
+	}
+	h := &webhookHandler{bot: bot}
+
+	e := new(giteePushEvent)
+	e.Ref = "refs/heads/master"
+	e.Repository.FullName = "openeuler/community"
+	e.Commits = append(e.Commits, struct {
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
+	}{
+		Modified: []string{"sig/Kernel/src-openeuler/k/kernel.yaml"},
+	})
+
+	h.handlePushEvent(e)
+	h.handlePushEvent(e)
+
+	evs := []*reconcileEvent{<-bot.events}
+	evs = mergeEvent(evs, <-bot.events)
+
+	if len(evs) != 1 || evs[0].target != bot.watchers[0] || !evs[0].repos.Has("kernel") {
+		t.Errorf("unexpected events: %v", evs)
+	}
+
+	if len(bot.events) != 0 {
+		t.Errorf("unexpected pending events: %d", len(bot.events))
+	}
+}